@@ -36,9 +36,15 @@ type Config struct {
 	Port            uint
 	Scheduler       *gocron.Scheduler
 	MaxInviteCount  int
-	Stytch          StytchConfig
-	Email           EmailConfig
-	Stripe          StripeConfig
+	// Number of days that deleted commits are kept for recovery before they're purged.
+	CommitRetentionDays int
+	// Number of days that deleted branches are kept for recovery before they're purged.
+	BranchRetentionDays int
+	// Number of minutes before a lock expires that its holder is notified.
+	LockExpiryWarningMinutes int
+	Stytch                   StytchConfig
+	Email                    EmailConfig
+	Stripe                   StripeConfig
 }
 
 // Global config instance
@@ -74,6 +80,42 @@ func InitConfig() {
 		log.Fatal("MAX_INVITE_COUNT must be greater than 0")
 	}
 
+	commitRetentionDaysStr := os.Getenv("COMMIT_RETENTION_DAYS")
+	if commitRetentionDaysStr == "" {
+		commitRetentionDaysStr = "30"
+	}
+	commitRetentionDays, err := strconv.Atoi(commitRetentionDaysStr)
+	if err != nil {
+		log.Fatal("COMMIT_RETENTION_DAYS must be an integer")
+	}
+	if commitRetentionDays < 0 {
+		log.Fatal("COMMIT_RETENTION_DAYS must not be negative")
+	}
+
+	branchRetentionDaysStr := os.Getenv("BRANCH_RETENTION_DAYS")
+	if branchRetentionDaysStr == "" {
+		branchRetentionDaysStr = "30"
+	}
+	branchRetentionDays, err := strconv.Atoi(branchRetentionDaysStr)
+	if err != nil {
+		log.Fatal("BRANCH_RETENTION_DAYS must be an integer")
+	}
+	if branchRetentionDays < 0 {
+		log.Fatal("BRANCH_RETENTION_DAYS must not be negative")
+	}
+
+	lockExpiryWarningMinutesStr := os.Getenv("LOCK_EXPIRY_WARNING_MINUTES")
+	if lockExpiryWarningMinutesStr == "" {
+		lockExpiryWarningMinutesStr = "60"
+	}
+	lockExpiryWarningMinutes, err := strconv.Atoi(lockExpiryWarningMinutesStr)
+	if err != nil {
+		log.Fatal("LOCK_EXPIRY_WARNING_MINUTES must be an integer")
+	}
+	if lockExpiryWarningMinutes < 0 {
+		log.Fatal("LOCK_EXPIRY_WARNING_MINUTES must not be negative")
+	}
+
 	// Stytch
 	sessionDurationMinutesStr := os.Getenv("SESSION_DURATION_MINUTES")
 	if sessionDurationMinutesStr == "" {
@@ -117,11 +159,14 @@ func InitConfig() {
 
 	// Construct and assign config instance
 	I = Config{
-		Debug:           os.Getenv("DEBUG") == "1",
-		LogResponseBody: os.Getenv("DEBUG_RES") == "1",
-		Port:            getPort(),
-		Scheduler:       gocron.NewScheduler(time.UTC),
-		MaxInviteCount:  maxInviteCount,
+		Debug:                    os.Getenv("DEBUG") == "1",
+		LogResponseBody:          os.Getenv("DEBUG_RES") == "1",
+		Port:                     getPort(),
+		Scheduler:                gocron.NewScheduler(time.UTC),
+		MaxInviteCount:           maxInviteCount,
+		CommitRetentionDays:      commitRetentionDays,
+		BranchRetentionDays:      branchRetentionDays,
+		LockExpiryWarningMinutes: lockExpiryWarningMinutes,
 		Stytch: StytchConfig{
 			SessionDurationMinutes:  int32(sessionDurationMinutes),
 			InviteExpirationMinutes: int32(inviteExp),
@@ -5,9 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/reflog_lib"
 	"github.com/decentvcs/server/lib/team_lib"
 	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
@@ -17,14 +24,20 @@ import (
 )
 
 // Get many branches.
+//
+// Query params (all optional):
+//   - "join_commit": If "true", each branch includes its head commit
+//   - "compare_to": Name of a base branch to compare each branch with, reporting the commits ahead and behind it and
+//     the number of paths changed since they diverged
 func GetManyBranches(c *fiber.Ctx) error {
 	// TODO: Add pagination
 
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 
 	// Get project from database
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	var project models.Project
@@ -43,7 +56,11 @@ func GetManyBranches(c *fiber.Ctx) error {
 
 	// Build mongo aggregation pipeline
 	pipeline := []bson.M{
-		{"$match": bson.M{"project_id": project.ID, "deleted_at": bson.M{"$exists": false}}},
+		{"$match": bson.M{
+			"project_id": project.ID,
+			"deleted_at": bson.M{"$exists": false},
+			"$and":       []bson.M{branch_lib.AccessFilter(userData, team.ID)},
+		}},
 	}
 
 	if c.Query("join_commit") == "true" {
@@ -66,6 +83,9 @@ func GetManyBranches(c *fiber.Ctx) error {
 		}...)
 	}
 
+	// Join locks
+	pipeline = append(pipeline, lock_lib.LookupStages()...)
+
 	// Get branches from database
 	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, pipeline)
 	if err != nil {
@@ -84,6 +104,41 @@ func GetManyBranches(c *fiber.Ctx) error {
 		result = []models.BranchWithCommit{}
 	}
 
+	// Compare each branch with the base branch
+	if compareTo := c.Query("compare_to"); compareTo != "" {
+		var base *models.BranchWithCommit
+		for i := range result {
+			if result[i].Name == compareTo {
+				base = &result[i]
+			}
+		}
+		if base == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Branch \"%s\" not found", compareTo),
+			})
+		}
+
+		baseHeadID := base.CommitID
+		if baseHeadID.IsZero() {
+			baseHeadID = base.Commit.ID
+		}
+		for i := range result {
+			headID := result[i].CommitID
+			if headID.IsZero() {
+				headID = result[i].Commit.ID
+			}
+
+			comparison, err := branch_lib.Compare(ctx, headID, baseHeadID)
+			if err != nil {
+				fmt.Printf("[GetManyBranches] Error comparing branch \"%s\": %v\n", result[i].Name, err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+			result[i].Comparison = comparison
+		}
+	}
+
 	return c.JSON(result)
 }
 
@@ -93,6 +148,14 @@ func GetOneBranch(c *fiber.Ctx) error {
 	projectName := c.Params("project_name")
 	branchName := c.Params("branch_name")
 
+	// Get "as_of" query param
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query param \"as_of\"; must be an RFC 3339 timestamp",
+		})
+	}
+
 	// Get project from database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -122,7 +185,7 @@ func GetOneBranch(c *fiber.Ctx) error {
 		},
 	}
 
-	if c.Query("join_commit") == "true" {
+	if c.Query("join_commit") == "true" || asOf != nil {
 		// Join commit
 		pipeline = append(pipeline, []bson.M{
 			{
@@ -142,6 +205,9 @@ func GetOneBranch(c *fiber.Ctx) error {
 		}...)
 	}
 
+	// Join locks
+	pipeline = append(pipeline, lock_lib.LookupStages()...)
+
 	// Get branch from database, including commit it currently points to
 	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, pipeline)
 	if err != nil {
@@ -162,6 +228,32 @@ func GetOneBranch(c *fiber.Ctx) error {
 		})
 	}
 
+	if asOf != nil {
+		if err := setCommitAsOf(ctx, &res, *asOf); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Branch did not exist at that time",
+				})
+			}
+
+			fmt.Printf("[GetOneBranch] Error getting commit as of time: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	if c.Query("join_commit") == "true" {
+		// Materialize the commit's full file map from its manifest
+		res.Commit.Files, err = commit_lib.GetFiles(ctx, &res.Commit)
+		if err != nil {
+			fmt.Printf("[GetOneBranch] Error getting commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
 	return c.JSON(res)
 }
 
@@ -170,6 +262,14 @@ func GetDefaultBranch(c *fiber.Ctx) error {
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 
+	// Get "as_of" query param
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query param \"as_of\"; must be an RFC 3339 timestamp",
+		})
+	}
+
 	// Get project
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -199,7 +299,7 @@ func GetDefaultBranch(c *fiber.Ctx) error {
 		},
 	}
 
-	if c.Query("join_commit") == "true" {
+	if c.Query("join_commit") == "true" || asOf != nil {
 		// Join commit
 		pipeline = append(pipeline, []bson.M{
 			{
@@ -219,6 +319,9 @@ func GetDefaultBranch(c *fiber.Ctx) error {
 		}...)
 	}
 
+	// Join locks
+	pipeline = append(pipeline, lock_lib.LookupStages()...)
+
 	// Get branch from database, including commit it currently points to
 	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, pipeline)
 	if err != nil {
@@ -240,6 +343,32 @@ func GetDefaultBranch(c *fiber.Ctx) error {
 			})
 		}
 
+		if asOf != nil {
+			if err := setCommitAsOf(ctx, &res, *asOf); err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+						"error": "Branch did not exist at that time",
+					})
+				}
+
+				fmt.Printf("[GetDefaultBranch] Error getting commit as of time: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+		}
+
+		if c.Query("join_commit") == "true" {
+			// Materialize the commit's full file map from its manifest
+			res.Commit.Files, err = commit_lib.GetFiles(ctx, &res.Commit)
+			if err != nil {
+				fmt.Printf("[GetDefaultBranch] Error getting commit files: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+		}
+
 		return c.JSON(res)
 	}
 
@@ -248,8 +377,120 @@ func GetDefaultBranch(c *fiber.Ctx) error {
 	})
 }
 
+// Get the full file map of the commit a branch points to.
+//
+// Query params (all optional):
+//   - "as_of": RFC 3339 timestamp; if set, uses the commit the branch pointed to at that time
+//   - "prefix": Only include paths starting with this prefix
+func GetBranchManifest(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Get "as_of" query param
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query param \"as_of\"; must be an RFC 3339 timestamp",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Get branch with commit
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchManifest] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if asOf != nil {
+		if err := setCommitAsOf(ctx, branch, *asOf); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Branch did not exist at that time",
+				})
+			}
+
+			fmt.Printf("[GetBranchManifest] Error getting commit as of time: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	// Materialize file map, optionally limited to a path prefix
+	files, err := commit_lib.GetFiles(ctx, &branch.Commit)
+	if err != nil {
+		fmt.Printf("[GetBranchManifest] Error getting commit files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if prefix := c.Query("prefix"); prefix != "" {
+		for path := range files {
+			if !strings.HasPrefix(path, prefix) {
+				delete(files, path)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"commit": fiber.Map{
+			"_id":   branch.Commit.ID,
+			"index": branch.Commit.Index,
+		},
+		"manifest_id": branch.Commit.ManifestID,
+		"files":       files,
+	})
+}
+
+// Parse the optional "as_of" query param as an RFC 3339 timestamp.
+// Returns nil if the param is not set.
+func parseAsOf(c *fiber.Ctx) (*time.Time, error) {
+	val := c.Query("as_of")
+	if val == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// Replace the joined commit of a branch with the commit the branch pointed to at the given time.
+//
+// Returns `mongo.ErrNoDocuments` if the branch didn't exist at the time.
+func setCommitAsOf(ctx context.Context, branch *models.BranchWithCommit, asOf time.Time) error {
+	if branch.CreatedAt.After(asOf) {
+		return mongo.ErrNoDocuments
+	}
+
+	commit, err := commit_lib.HeadAt(ctx, branch.ID, branch.Commit.ID, asOf)
+	if err != nil {
+		return err
+	}
+
+	branch.Commit = *commit
+	return nil
+}
+
 // Create a new branch.
 func CreateBranch(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 
@@ -294,59 +535,93 @@ func CreateBranch(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get commit by index
-	var commit models.Commit
-	err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"project_id": project.ID, "index": body.CommitIndex}).Decode(&commit)
+	// Get commit by index or tag name
+	commitRef := strconv.Itoa(body.CommitIndex)
+	if body.Tag != "" {
+		commitRef = body.Tag
+	}
+
+	commit, err := commit_lib.ResolveRef(ctx, project.ID, primitive.NilObjectID, commitRef)
 	if err == mongo.ErrNoDocuments {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Commit not found",
 		})
 	}
+	if err != nil {
+		fmt.Printf("[CreateBranch] Error getting commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
 
-	// Check if branch already exists
-	var branch models.Branch
-	err = config.MI.DB.Collection("branches").FindOne(ctx, bson.M{"project_id": project.ID, "name": body.Name}).Decode(&branch)
-	if err != nil && err != mongo.ErrNoDocuments {
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, commit.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[CreateBranch] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Commit not found",
+		})
+	}
+
+	// Check if branch already exists.
+	// Soft-deleted branches with the same name are left alone; they can be restored under another name.
+	count, err := config.MI.DB.Collection("branches").CountDocuments(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       body.Name,
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
 		fmt.Printf("[CreateBranch] Error getting branch: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
-	if err == nil {
-		if branch.DeletedAt.IsZero() {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error": "Branch already exists",
-			})
-		} else {
-			// Unset "deleted_at" for existing branch
-			_, err = config.MI.DB.Collection("branches").UpdateOne(ctx, bson.M{"project_id": project.ID, "_id": branch.ID}, bson.M{"$unset": bson.M{"deleted_at": ""}})
-			if err != nil {
-				fmt.Printf("Error unsetting \"deleted_at\" for existing branch w/ ID \"%s\": %+v\n", branch.ID, err)
-				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error": "Internal server error",
-				})
-			}
-		}
-	} else if errors.Is(err, mongo.ErrNoDocuments) {
-		// Create new branch
-		branch := models.BranchCreateBSON{
-			ID:        primitive.NewObjectID(),
-			CreatedAt: time.Now(),
-			Name:      body.Name,
-			ProjectID: project.ID,
-			CommitID:  commit.ID,
-		}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Branch already exists",
+		})
+	}
 
-		// Create branch in database
-		_, err = config.MI.DB.Collection("branches").InsertOne(ctx, branch)
-		if err != nil {
-			fmt.Printf("[CreateBranch] Error creating new branch: %v\n", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Internal server error",
-			})
-		}
+	// Create new branch
+	visibility := body.Visibility
+	if visibility == "" {
+		visibility = models.BranchVisibilityTeam
+	}
+	branch := models.BranchCreateBSON{
+		ID:         primitive.NewObjectID(),
+		CreatedAt:  time.Now(),
+		Name:       body.Name,
+		ProjectID:  project.ID,
+		OwnerID:    userData.UserID,
+		Visibility: visibility,
+		CommitID:   commit.ID,
+	}
 
-		return c.JSON(branch)
+	// Create branch in database
+	_, err = config.MI.DB.Collection("branches").InsertOne(ctx, branch)
+	if err != nil {
+		fmt.Printf("[CreateBranch] Error creating new branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if err := reflog_lib.Record(ctx, &models.ReflogEntry{
+		ProjectID:   project.ID,
+		BranchID:    branch.ID,
+		NewCommitID: commit.ID,
+		UserID:      userData.UserID,
+		Operation:   models.ReflogOperationCreate,
+	}); err != nil {
+		fmt.Printf("[CreateBranch] Error recording reflog entry: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
 	}
 
 	return c.JSON(branch)
@@ -384,11 +659,36 @@ func UpdateBranch(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get branch from database
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[UpdateBranch] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	if body.Name != branch.Name && branch_lib.GetProtection(&project, branch.ID, branch.Name).ForbidRename {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": fmt.Sprintf("Branch \"%s\" is protected; renaming it is not allowed", branch.Name),
+		})
+	}
+
 	// Update branch
-	filter := bson.M{"project_id": project.ID, "name": branchName}
 	_, err := config.MI.DB.Collection("branches").UpdateOne(
 		ctx,
-		filter,
+		bson.M{"_id": branch.ID},
 		bson.M{"$set": bson.M{"name": body.Name}},
 	)
 	if err != nil {
@@ -456,9 +756,39 @@ func SoftDeleteOneBranch(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get branch from database
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[SoftDeleteOneBranch] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	if branch.ID == project.DefaultBranchID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Cannot delete the default branch of a project",
+		})
+	}
+	if branch_lib.GetProtection(&project, branch.ID, branch.Name).ForbidDeletion {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": fmt.Sprintf("Branch \"%s\" is protected; deleting it is not allowed", branch.Name),
+		})
+	}
+
 	// Soft-delete branch
-	filter := bson.M{"project_id": project.ID, "name": branchName}
-	_, err = config.MI.DB.Collection("branches").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"deleted_at": time.Now()}})
+	_, err = config.MI.DB.Collection("branches").UpdateOne(ctx, bson.M{"_id": branch.ID}, bson.M{"$set": bson.M{"deleted_at": time.Now()}})
 	if err != nil {
 		fmt.Printf("[SoftDeleteOneBranch] Error soft-deleting branch: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -470,3 +800,253 @@ func SoftDeleteOneBranch(c *fiber.Ctx) error {
 		"message": "Branch deleted successfully",
 	})
 }
+
+// Get the soft-deleted branches of a project that haven't been purged yet, most recently deleted first.
+// Each branch includes the commit it pointed to when it was deleted.
+func GetManyDeletedBranches(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetManyDeletedBranches] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branches from database
+	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, append([]bson.M{
+		{"$match": bson.M{
+			"project_id": project.ID,
+			"deleted_at": bson.M{"$exists": true},
+			"$and":       []bson.M{branch_lib.AccessFilter(userData, team.ID)},
+		}},
+		{"$sort": bson.M{"deleted_at": -1}},
+		{
+			"$lookup": bson.M{
+				"from":         "commits",
+				"localField":   "commit_id",
+				"foreignField": "_id",
+				"as":           "commit",
+			},
+		},
+		{
+			"$unwind": "$commit",
+		},
+		{
+			"$unset": []string{"commit_id", "commit.changed_files"},
+		},
+	}, lock_lib.LookupStages()...))
+	if err != nil {
+		fmt.Printf("[GetManyDeletedBranches] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	defer cur.Close(ctx)
+
+	var result []models.BranchWithCommit
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.BranchWithCommit{}
+	}
+
+	return c.JSON(result)
+}
+
+// Restore a soft-deleted branch with the head it had when it was deleted.
+//
+// The branch can be given a new name in the request body, which is required if another branch with its name was
+// created in the meantime.
+func UndeleteBranch(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	branchID, err := primitive.ObjectIDFromHex(c.Params("branch_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid branch ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Parse body
+	var body models.BranchUpdateDTO
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Bad request",
+			})
+		}
+	}
+
+	// Get project
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[UndeleteBranch] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get deleted branch from database.
+	// Branches past the retention period may already be partially purged, so they can't be restored.
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"_id":        branchID,
+		"project_id": project.ID,
+		"deleted_at": bson.M{"$gte": time.Now().AddDate(0, 0, -config.I.BranchRetentionDays)},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Deleted branch not found",
+			})
+		}
+
+		fmt.Printf("[UndeleteBranch] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !branch_lib.CanAccess(branch.Visibility, branch.OwnerID, userData, team.ID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Deleted branch not found",
+		})
+	}
+
+	name := branch.Name
+	if body.Name != "" {
+		// Validate branch name
+		regex := regexp.MustCompile(`^[\w\-\.]+$`)
+		if !regex.MatchString(body.Name) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid branch name; must be alphanumeric with dashes",
+			})
+		}
+
+		name = body.Name
+	}
+
+	// Make sure the name isn't taken by another branch
+	count, err := config.MI.DB.Collection("branches").CountDocuments(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       name,
+		"deleted_at": bson.M{"$exists": false},
+	})
+	if err != nil {
+		fmt.Printf("[UndeleteBranch] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Branch \"%s\" already exists; restore the deleted branch under another name", name),
+		})
+	}
+
+	// Restore branch
+	if _, err := config.MI.DB.Collection("branches").UpdateOne(
+		ctx,
+		bson.M{"_id": branch.ID},
+		bson.M{"$set": bson.M{"name": name}, "$unset": bson.M{"deleted_at": ""}},
+	); err != nil {
+		fmt.Printf("[UndeleteBranch] Error restoring branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	branch.Name = name
+	branch.DeletedAt = time.Time{}
+
+	return c.JSON(branch)
+}
+
+// Publish a private branch, making it visible to the whole team.
+// Private branches are only accessible to their owner and admins, so only they can publish them.
+func PublishBranch(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Get project
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[PublishBranch] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch from database
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[PublishBranch] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if branch.Visibility != models.BranchVisibilityPrivate {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Branch is already visible to the team",
+		})
+	}
+
+	// Publish branch
+	if _, err := config.MI.DB.Collection("branches").UpdateOne(
+		ctx,
+		bson.M{"_id": branch.ID},
+		bson.M{"$set": bson.M{"visibility": models.BranchVisibilityTeam}},
+	); err != nil {
+		fmt.Printf("[PublishBranch] Error publishing branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	branch.Visibility = models.BranchVisibilityTeam
+
+	return c.JSON(branch)
+}
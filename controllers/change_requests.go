@@ -0,0 +1,884 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/change_request_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/team_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Get many change requests for a project, newest first.
+//
+// Query params (all optional):
+//   - "status": Only return change requests with this status ("open", "merged" or "closed")
+func GetManyChangeRequests(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	status := models.ChangeRequestStatus(c.Query("status"))
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetManyChangeRequests] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get change requests from database
+	filter := bson.M{"project_id": project.ID}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cur, err := config.MI.DB.Collection("change_requests").Find(ctx, filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		fmt.Printf("[GetManyChangeRequests] Error getting change requests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.ChangeRequest
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.ChangeRequest{}
+	}
+
+	return c.JSON(result)
+}
+
+// Get one change request along with the state of its reviews.
+func GetOneChangeRequest(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	project, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[GetOneChangeRequest] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	result := fiber.Map{
+		"change_request":     changeRequest,
+		"required_approvals": project.RequiredApprovals,
+	}
+
+	// Reviews only matter while the change request is open
+	if changeRequest.Status == models.ChangeRequestStatusOpen {
+		source, _, err := change_request_lib.GetBranches(ctx, changeRequest)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			fmt.Printf("[GetOneChangeRequest] Error getting branches: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		if source != nil {
+			approvals, changesRequested, err := change_request_lib.GetReviewSummary(ctx, changeRequest.ID, source.Commit.ID)
+			if err != nil {
+				fmt.Printf("[GetOneChangeRequest] Error getting reviews: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+
+			result["head"] = source.Commit.ID
+			result["approvals"] = approvals
+			result["changes_requested"] = changesRequested
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// Create a change request to merge a source branch into a target branch.
+func CreateChangeRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Parse request body
+	var reqBody models.CreateChangeRequestRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[CreateChangeRequest] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get source and target branches from database
+	var branches [2]models.Branch
+	for i, name := range []string{reqBody.SourceBranch, reqBody.TargetBranch} {
+		if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+			"project_id": project.ID,
+			"name":       name,
+			"deleted_at": bson.M{"$exists": false},
+		}).Decode(&branches[i]); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": fmt.Sprintf("Branch \"%s\" not found", name),
+				})
+			}
+
+			fmt.Printf("[CreateChangeRequest] Error getting branch: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+	for _, branch := range branches {
+		if !branch_lib.CanAccess(branch.Visibility, branch.OwnerID, userData, team.ID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Branch \"%s\" not found", branch.Name),
+			})
+		}
+		if branch.Visibility == models.BranchVisibilityPrivate {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Branch \"%s\" is private; publish it before opening a change request", branch.Name),
+			})
+		}
+	}
+	source, target := branches[0], branches[1]
+
+	// Create change request
+	changeRequest := models.ChangeRequest{
+		ID:             primitive.NewObjectID(),
+		CreatedAt:      time.Now(),
+		ProjectID:      project.ID,
+		Title:          reqBody.Title,
+		Description:    reqBody.Description,
+		AuthorID:       userData.UserID,
+		SourceBranchID: source.ID,
+		TargetBranchID: target.ID,
+		Status:         models.ChangeRequestStatusOpen,
+	}
+	if _, err := config.MI.DB.Collection("change_requests").InsertOne(ctx, changeRequest); err != nil {
+		// Only one change request can be open for the same pair of branches
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("A change request to merge \"%s\" into \"%s\" is already open", source.Name, target.Name),
+			})
+		}
+
+		fmt.Printf("[CreateChangeRequest] Error creating change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(changeRequest)
+}
+
+// Get the changes a change request would merge, computed from its source branch's head since the nearest common
+// ancestor with the target branch's head, along with any conflicting paths.
+func GetChangeRequestDiff(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[GetChangeRequestDiff] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch heads
+	source, target, err := change_request_lib.GetBranches(ctx, changeRequest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The source or target branch of the change request no longer exists",
+			})
+		}
+
+		fmt.Printf("[GetChangeRequestDiff] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	diff, err := change_request_lib.Diff(ctx, &source.Commit, &target.Commit)
+	if err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The source and target branches have no common history",
+			})
+		}
+
+		fmt.Printf("[GetChangeRequestDiff] Error computing diff: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Omit large fields of the commits
+	for _, commit := range []*models.Commit{diff.MergeBase, diff.Source, diff.Target} {
+		commit.CreatedFiles = nil
+		commit.ModifiedFiles = nil
+		commit.DeletedFiles = nil
+		commit.ChangedFiles = nil
+	}
+
+	return c.JSON(diff)
+}
+
+// Close a change request without merging it. Only its author and admins can close it.
+func CloseChangeRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[CloseChangeRequest] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if changeRequest.AuthorID != userData.UserID && !acl.IsRoleAtLeast(acl.GetTeamRole(userData, team.ID), models.RoleAdmin) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the author of a change request and admins can close it",
+		})
+	}
+
+	// Close change request, unless it was merged or closed in the meantime
+	now := time.Now()
+	res, err := config.MI.DB.Collection("change_requests").UpdateOne(
+		ctx,
+		bson.M{"_id": changeRequest.ID, "status": models.ChangeRequestStatusOpen},
+		bson.M{"$set": bson.M{"status": models.ChangeRequestStatusClosed, "closed_at": now, "closed_by": userData.UserID}},
+	)
+	if err != nil {
+		fmt.Printf("[CloseChangeRequest] Error closing change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Change request is not open",
+		})
+	}
+
+	changeRequest.Status = models.ChangeRequestStatusClosed
+	changeRequest.ClosedAt = &now
+	changeRequest.ClosedBy = userData.UserID
+
+	return c.JSON(changeRequest)
+}
+
+// Get all reviews of a change request, oldest first.
+func GetManyChangeRequestReviews(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[GetManyChangeRequestReviews] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	cur, err := config.MI.DB.Collection("change_request_reviews").Find(
+		ctx,
+		bson.M{"change_request_id": changeRequest.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		fmt.Printf("[GetManyChangeRequestReviews] Error getting reviews: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.ChangeRequestReview
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.ChangeRequestReview{}
+	}
+
+	return c.JSON(result)
+}
+
+// Get all comments of a change request, oldest first.
+func GetManyChangeRequestComments(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[GetManyChangeRequestComments] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	cur, err := config.MI.DB.Collection("change_request_comments").Find(
+		ctx,
+		bson.M{"change_request_id": changeRequest.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		fmt.Printf("[GetManyChangeRequestComments] Error getting comments: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.ChangeRequestComment
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.ChangeRequestComment{}
+	}
+
+	return c.JSON(result)
+}
+
+// Approve or request changes to the current head of a change request's source branch.
+func CreateChangeRequestReview(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Parse request body
+	var reqBody models.CreateChangeRequestReviewRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	commitID, err := primitive.ObjectIDFromHex(reqBody.CommitID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid commit ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[CreateChangeRequestReview] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if changeRequest.Status != models.ChangeRequestStatusOpen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Change request is not open",
+		})
+	}
+	if changeRequest.AuthorID == userData.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Authors cannot review their own change requests",
+		})
+	}
+
+	// Make sure the reviewer saw the latest changes
+	source, _, err := change_request_lib.GetBranches(ctx, changeRequest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The source or target branch of the change request no longer exists",
+			})
+		}
+
+		fmt.Printf("[CreateChangeRequestReview] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if source.Commit.ID != commitID {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "The source branch has new commits; review the latest changes",
+			"head":  source.Commit.ID,
+		})
+	}
+
+	// Create review
+	review := models.ChangeRequestReview{
+		ID:              primitive.NewObjectID(),
+		CreatedAt:       time.Now(),
+		ChangeRequestID: changeRequest.ID,
+		ReviewerID:      userData.UserID,
+		State:           reqBody.State,
+		CommitID:        commitID,
+		Body:            reqBody.Body,
+	}
+	if _, err := config.MI.DB.Collection("change_request_reviews").InsertOne(ctx, review); err != nil {
+		fmt.Printf("[CreateChangeRequestReview] Error creating review: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(review)
+}
+
+// Comment on a change request, optionally about a file or in reply to another comment.
+func CreateChangeRequestComment(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Parse request body
+	var reqBody models.CreateChangeRequestCommentRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[CreateChangeRequestComment] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	comment := models.ChangeRequestComment{
+		ID:              primitive.NewObjectID(),
+		CreatedAt:       time.Now(),
+		ChangeRequestID: changeRequest.ID,
+		AuthorID:        userData.UserID,
+		Body:            reqBody.Body,
+		Path:            reqBody.Path,
+	}
+
+	// Replies must belong to the same change request
+	if reqBody.ParentID != "" {
+		parentID, err := primitive.ObjectIDFromHex(reqBody.ParentID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid parent comment ID; must be an ObjectID hexadecimal",
+			})
+		}
+
+		count, err := config.MI.DB.Collection("change_request_comments").CountDocuments(ctx, bson.M{"_id": parentID, "change_request_id": changeRequest.ID})
+		if err != nil {
+			fmt.Printf("[CreateChangeRequestComment] Error getting parent comment: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		if count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Parent comment not found",
+			})
+		}
+
+		comment.ParentID = parentID
+	}
+
+	if _, err := config.MI.DB.Collection("change_request_comments").InsertOne(ctx, comment); err != nil {
+		fmt.Printf("[CreateChangeRequestComment] Error creating comment: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(comment)
+}
+
+// Merge a change request by creating a merge commit on the target branch.
+//
+// Only allowed once the latest changes have the project's required number of approvals, no reviewer requested
+// changes to them, and no paths conflict. If the target branch requires a linear history, the merge commit only has
+// the target's head as its parent.
+func MergeChangeRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	changeRequestID, err := primitive.ObjectIDFromHex(c.Params("change_request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid change request ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	// Get change request from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	project, changeRequest, err := change_request_lib.GetOne(ctx, team.ID, projectName, changeRequestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Change request not found",
+			})
+		}
+
+		fmt.Printf("[MergeChangeRequest] Error getting change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if changeRequest.Status != models.ChangeRequestStatusOpen {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Change request is not open",
+		})
+	}
+
+	// Get branch heads
+	source, target, err := change_request_lib.GetBranches(ctx, changeRequest)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The source or target branch of the change request no longer exists",
+			})
+		}
+
+		fmt.Printf("[MergeChangeRequest] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(project, target.ID, target.Name)
+	if reason := branch_lib.CommitDeniedReason(protection, acl.GetTeamRole(userData, team.ID), target.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	// Check reviews of the latest changes
+	approvals, changesRequested, err := change_request_lib.GetReviewSummary(ctx, changeRequest.ID, source.Commit.ID)
+	if err != nil {
+		fmt.Printf("[MergeChangeRequest] Error getting reviews: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if approvals < project.RequiredApprovals {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": fmt.Sprintf("The latest changes need %d approval(s) before merging; they have %d", project.RequiredApprovals, approvals),
+		})
+	}
+	if changesRequested {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "A reviewer requested changes to the latest changes",
+		})
+	}
+
+	// Compute changes and check for conflicts
+	diff, err := change_request_lib.Diff(ctx, &source.Commit, &target.Commit)
+	if err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The source and target branches have no common history",
+			})
+		}
+
+		fmt.Printf("[MergeChangeRequest] Error computing diff: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if len(diff.Conflicts) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":     "The change request has conflicts with the target branch",
+			"conflicts": diff.Conflicts,
+		})
+	}
+	if len(diff.Created) == 0 && len(diff.Modified) == 0 && len(diff.Deleted) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to merge; the target branch already has all changes",
+		})
+	}
+
+	createdFiles := lo.Keys(diff.Created)
+	modifiedFiles := lo.Keys(diff.Modified)
+	sort.Strings(createdFiles)
+	sort.Strings(modifiedFiles)
+
+	// Check if any changed path is locked by another user in the target branch
+	for _, path := range append(append(append([]string{}, createdFiles...), modifiedFiles...), diff.Deleted...) {
+		if lockedBy, ok := target.Locks[path]; ok && lockedBy != userData.UserID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("File \"%s\" is locked by %s", path, lockedBy),
+			})
+		}
+	}
+	existingFiles := append(append([]string{}, modifiedFiles...), diff.Deleted...)
+	if unheld := lock_lib.UnheldExclusivePaths(project.ExclusiveCheckoutPatterns, target.Locks, userData.UserID, existingFiles); len(unheld) > 0 {
+		return exclusiveCheckoutResponse(c, unheld)
+	}
+
+	changedFiles := make(map[string]models.FileData, len(diff.Created)+len(diff.Modified))
+	for path, data := range diff.Created {
+		changedFiles[path] = data
+	}
+	for path, data := range diff.Modified {
+		changedFiles[path] = data
+	}
+
+	parentIDs := []primitive.ObjectID{target.Commit.ID, source.Commit.ID}
+	if protection.RequireLinearHistory {
+		parentIDs = parentIDs[:1]
+	}
+
+	// Create merge commit
+	commit := models.Commit{
+		ID:            primitive.NewObjectID(),
+		CreatedAt:     time.Now(),
+		ProjectID:     project.ID,
+		BranchID:      target.ID,
+		ParentIDs:     parentIDs,
+		Message:       fmt.Sprintf("Merge branch \"%s\" into \"%s\"\n\n%s", source.Name, target.Name, changeRequest.Title),
+		CreatedFiles:  createdFiles,
+		ModifiedFiles: modifiedFiles,
+		DeletedFiles:  diff.Deleted,
+		ChangedFiles:  changedFiles,
+		AuthorID:      userData.UserID,
+	}
+
+	// Mark change request as merged in the same transaction, so that it can only be merged once
+	now := time.Now()
+	markMerged := func(ctx context.Context) error {
+		res, err := config.MI.DB.Collection("change_requests").UpdateOne(
+			ctx,
+			bson.M{"_id": changeRequest.ID, "status": models.ChangeRequestStatusOpen},
+			bson.M{"$set": bson.M{
+				"status":          models.ChangeRequestStatusMerged,
+				"closed_at":       now,
+				"closed_by":       userData.UserID,
+				"merge_commit_id": commit.ID,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return change_request_lib.ErrNotOpen
+		}
+
+		return nil
+	}
+
+	if err = commit_lib.CreateWith(ctx, &commit, target.Commit.ID, models.ReflogOperationMerge, markMerged); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("Branch \"%s\" has moved while merging; try again", target.Name),
+			})
+		}
+		if errors.Is(err, change_request_lib.ErrNotOpen) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Change request is not open",
+			})
+		}
+
+		fmt.Printf("[MergeChangeRequest] Error merging change request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	changeRequest.Status = models.ChangeRequestStatusMerged
+	changeRequest.ClosedAt = &now
+	changeRequest.ClosedBy = userData.UserID
+	changeRequest.MergeCommitID = commit.ID
+
+	// Omit large fields to prevent memory issues
+	commit.CreatedFiles = nil
+	commit.ModifiedFiles = nil
+	commit.DeletedFiles = nil
+	commit.ChangedFiles = nil
+
+	return c.JSON(fiber.Map{
+		"change_request": changeRequest,
+		"commit":         commit,
+	})
+}
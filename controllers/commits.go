@@ -4,25 +4,61 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
 	"github.com/decentvcs/server/lib/auth"
 	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/graph_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/manifest_lib"
+	"github.com/decentvcs/server/lib/signing"
 	"github.com/decentvcs/server/lib/team_lib"
 	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
+	"github.com/samber/lo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Get many commits for the given project.
+// Get many commits for the given project, newest first.
+//
+// Query params (all optional):
+//   - "branch_name": Only return commits made in this branch
+//   - "limit": Max number of commits to return (default 10)
+//   - "cursor": Cursor from the "X-Next-Cursor" or "X-Prev-Cursor" header of a previous response
+//   - "before"/"after": ID of a commit to return commits made before/after (ignored if "cursor" is set)
+//   - "exclude_files": If "true", omits the changed file data of each commit
+//   - "as_of": RFC 3339 timestamp; if set, returns the first-parent history of the branch's head at that time
+//     (requires "branch_name")
+//
+// The total number of matching commits is returned in the "X-Total-Count" header.
 func GetManyCommits(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 
+	// Get "as_of" query param
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query param \"as_of\"; must be an RFC 3339 timestamp",
+		})
+	}
+	if asOf != nil && c.Query("branch_name") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Query param \"as_of\" requires \"branch_name\"",
+		})
+	}
+
 	// Get limit query param
 	limitStr := c.Query("limit")
 	if limitStr == "" {
@@ -33,6 +69,18 @@ func GetManyCommits(c *fiber.Ctx) error {
 		limit = 10
 	}
 
+	// Get cursor
+	var cursor *commit_lib.Cursor
+	if token := c.Query("cursor"); token != "" {
+		decoded, err := commit_lib.DecodeCursor(token)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		cursor = &decoded
+	}
+
 	// Get compared commit ID as string
 	comparedCommitIdStr := c.Query("before")
 	if comparedCommitIdStr == "" {
@@ -61,7 +109,7 @@ func GetManyCommits(c *fiber.Ctx) error {
 	var branch models.Branch
 	branchName := c.Query("branch_name")
 	if branchName != "" {
-		if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{"project_id": project.ID, "name": branchName}).Decode(&branch); err != nil {
+		if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{"project_id": project.ID, "name": branchName, "deleted_at": bson.M{"$exists": false}}).Decode(&branch); err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 					"error": "Branch not found",
@@ -73,11 +121,15 @@ func GetManyCommits(c *fiber.Ctx) error {
 				"error": "Internal server error",
 			})
 		}
+		if !branch_lib.CanAccess(branch.Visibility, branch.OwnerID, userData, team.ID) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
 	}
 
-	// If "before" or "after" query param set, get it from database
-	var comparedCommit models.Commit
-	if comparedCommitIdStr != "" {
+	// If "before" or "after" query param set, get it from database and use it as the cursor
+	if cursor == nil && comparedCommitIdStr != "" {
 		comparedCommitId, err := primitive.ObjectIDFromHex(comparedCommitIdStr)
 		if err != nil {
 			fmt.Printf("[GetManyCommits] Error getting compared commit: %v\n", err)
@@ -88,6 +140,7 @@ func GetManyCommits(c *fiber.Ctx) error {
 		}
 
 		// Get compared commit from database
+		var comparedCommit models.Commit
 		err = config.MI.DB.Collection("commits").FindOne(ctx, bson.M{
 			"_id":        comparedCommitId,
 			"project_id": project.ID,
@@ -98,38 +151,195 @@ func GetManyCommits(c *fiber.Ctx) error {
 				"message": "No commit found for query param",
 			})
 		}
+
+		cursor = &commit_lib.Cursor{
+			CreatedAt: comparedCommit.CreatedAt,
+			ID:        comparedCommit.ID,
+			Prev:      c.Query("before") == "",
+		}
 	}
 
 	// Build bson filter
-	filter := bson.M{"project_id": project.ID}
+	filter := bson.M{"project_id": project.ID, "deleted_at": bson.M{"$exists": false}}
+
+	if branchName != "" {
+		filter["branch_id"] = branch.ID
+	} else {
+		// Hide commits of private branches the user can't access
+		inaccessibleIDs, err := branch_lib.InaccessibleIDs(ctx, project.ID, userData, team.ID)
+		if err != nil {
+			fmt.Printf("[GetManyCommits] Error getting inaccessible branches: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		if len(inaccessibleIDs) > 0 {
+			filter["branch_id"] = bson.M{"$nin": inaccessibleIDs}
+		}
+	}
+
+	if asOf != nil {
+		// Resolve the head the branch pointed to at the time, honoring resets and restores
+		if branch.CreatedAt.After(*asOf) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch did not exist at that time",
+			})
+		}
 
-	if comparedCommitIdStr != "" {
-		if c.Query("before") != "" {
-			// Before
-			filter["created_at"] = bson.M{
-				"$lt": comparedCommit.CreatedAt,
+		head, err := commit_lib.HeadAt(ctx, branch.ID, branch.CommitID, *asOf)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Branch did not exist at that time",
+				})
 			}
+
+			fmt.Printf("[GetManyCommits] Error getting commit as of time: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		// The history at the time is the first-parent history of its head, including commits inherited from other
+		// branches and commits that were removed from the branch since
+		history, err := commit_lib.GetFirstParentHistory(ctx, head.ID)
+		if err != nil {
+			fmt.Printf("[GetManyCommits] Error getting history: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return getCommitHistoryPage(c, ctx, history, cursor, limit)
+	}
+
+	// Count all matching commits, regardless of page
+	total, err := config.MI.DB.Collection("commits").CountDocuments(ctx, filter)
+	if err != nil {
+		fmt.Printf("[GetManyCommits] Error counting commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Sort newest first, or oldest first when paging backwards (reversed below)
+	sortOrder := -1
+	pageFilter := filter
+	if cursor != nil {
+		pageFilter = bson.M{"$and": bson.A{filter, cursor.Filter()}}
+		if cursor.Prev {
+			sortOrder = 1
+		}
+	}
+
+	// Get one extra commit to know whether there's another page
+	result, err := getCommitsWithBranch(ctx, pageFilter, sortOrder, limit+1, c.Query("exclude_files") == "true")
+	if err != nil {
+		fmt.Printf("[GetManyCommits] Error getting commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	hasMore := int64(len(result)) > limit
+	if hasMore {
+		result = result[:limit]
+	}
+	if cursor != nil && cursor.Prev {
+		result = lo.Reverse(result)
+	}
+
+	// Set cursors for adjacent pages.
+	// The extra commit tells whether there's another page in the direction of paging. In the opposite direction,
+	// there's another page only if a cursor was given.
+	hasNewer, hasOlder := false, hasMore
+	if cursor != nil {
+		if cursor.Prev {
+			hasNewer, hasOlder = hasMore, true
 		} else {
-			// After
-			filter["created_at"] = bson.M{
-				"$gt": comparedCommit.CreatedAt,
-			}
+			hasNewer = true
+		}
+	}
+	if len(result) > 0 {
+		first, last := result[0], result[len(result)-1]
+		if hasNewer {
+			c.Set("X-Prev-Cursor", commit_lib.EncodeCursor(commit_lib.Cursor{CreatedAt: first.CreatedAt, ID: first.ID, Prev: true}))
+		}
+		if hasOlder {
+			c.Set("X-Next-Cursor", commit_lib.EncodeCursor(commit_lib.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}))
 		}
 	}
+	c.Set("X-Total-Count", strconv.FormatInt(total, 10))
 
-	if branchName != "" {
-		filter["branch_id"] = branch.ID
+	return c.JSON(result)
+}
+
+// Respond with a page of a first-parent history, given as commit IDs ordered newest first.
+// Cursors must point to commits in the history.
+func getCommitHistoryPage(c *fiber.Ctx, ctx context.Context, history []primitive.ObjectID, cursor *commit_lib.Cursor, limit int64) error {
+	start, end := 0, len(history)
+	if cursor != nil {
+		position := lo.IndexOf(history, cursor.ID)
+		if position == -1 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+
+		if cursor.Prev {
+			end = position
+		} else {
+			start = position + 1
+		}
+	}
+	if cursor != nil && cursor.Prev {
+		start = lo.Max([]int{start, end - int(limit)})
+	} else {
+		end = lo.Min([]int{end, start + int(limit)})
+	}
+	pageIDs := history[start:end]
+
+	commits, err := getCommitsWithBranch(ctx, bson.M{"_id": bson.M{"$in": pageIDs}}, -1, limit, c.Query("exclude_files") == "true")
+	if err != nil {
+		fmt.Printf("[GetManyCommits] Error getting commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Order commits as in the history
+	byID := lo.KeyBy(commits, func(commit models.CommitWithBranch) primitive.ObjectID { return commit.ID })
+	result := []models.CommitWithBranch{}
+	for _, id := range pageIDs {
+		if commit, ok := byID[id]; ok {
+			result = append(result, commit)
+		}
+	}
+
+	if len(result) > 0 {
+		first, last := result[0], result[len(result)-1]
+		if start > 0 {
+			c.Set("X-Prev-Cursor", commit_lib.EncodeCursor(commit_lib.Cursor{CreatedAt: first.CreatedAt, ID: first.ID, Prev: true}))
+		}
+		if end < len(history) {
+			c.Set("X-Next-Cursor", commit_lib.EncodeCursor(commit_lib.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}))
+		}
 	}
+	c.Set("X-Total-Count", strconv.Itoa(len(history)))
+
+	return c.JSON(result)
+}
 
-	// Get commits from mongo
-	// Includes branch
-	cur, err := config.MI.DB.Collection("commits").Aggregate(ctx, []bson.M{
+// Get commits matching a filter, sorted by creation time, along with their branch if it still exists.
+func getCommitsWithBranch(ctx context.Context, filter bson.M, sortOrder int, limit int64, excludeFiles bool) ([]models.CommitWithBranch, error) {
+	pipeline := []bson.M{
 		{
 			"$match": filter,
 		},
 		{
-			"$sort": bson.M{
-				"created_at": -1, // ascending
+			"$sort": bson.D{
+				{Key: "created_at", Value: sortOrder},
+				{Key: "_id", Value: sortOrder},
 			},
 		},
 		{
@@ -144,54 +354,122 @@ func GetManyCommits(c *fiber.Ctx) error {
 			},
 		},
 		{
-			"$unwind": "$branch",
+			"$unwind": bson.M{
+				"path":                       "$branch",
+				"preserveNullAndEmptyArrays": true,
+			},
 		},
 		{
 			"$unset": "branch_id",
 		},
-	})
+	}
+
+	if excludeFiles {
+		pipeline = append(pipeline, bson.M{"$unset": "changed_files"})
+	}
+
+	cur, err := config.MI.DB.Collection("commits").Aggregate(ctx, pipeline)
 	if err != nil {
-		fmt.Printf("[GetManyCommits] Error getting commits: %v\n", err)
+		return nil, err
+	}
+
+	result := []models.CommitWithBranch{}
+	if err := cur.All(ctx, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Get one commit by index or tag name.
+func GetOneCommit(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	commitRef := c.Params("commit_index")
+
+	// Commits never change, so a point in time only makes sense for branches
+	if c.Query("as_of") != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Query param \"as_of\" is only supported for branches; use the branch endpoints instead",
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetOneCommit] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get commit from database
+	result, err := commit_lib.ResolveRef(ctx, project.ID, primitive.NilObjectID, commitRef)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+	if err != nil {
+		fmt.Printf("[GetOneCommit] Error getting commit: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
-	defer cur.Close(ctx)
 
-	// Iterate over the results and decode into slice of Commits
-	var result []models.CommitWithBranch
-	for cur.Next(ctx) {
-		var decoded models.CommitWithBranch
-		err := cur.Decode(&decoded)
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, result.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[GetOneCommit] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	if c.Query("include_files") == "true" {
+		// Materialize the commit's full file map from its manifest
+		result.Files, err = commit_lib.GetFiles(ctx, result)
 		if err != nil {
-			fmt.Printf("[GetManyCommits] Error decoding commits: %v\n", err)
+			fmt.Printf("[GetOneCommit] Error getting commit files: %v\n", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Internal server error",
 			})
 		}
-
-		result = append(result, decoded)
 	}
 
 	return c.JSON(result)
 }
 
-// Get one commit by index.
-func GetOneCommit(c *fiber.Ctx) error {
+// Get the full file map of a commit.
+func GetCommitManifest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
+	commitRef := c.Params("commit_index")
 
-	// Get branch index
-	idx, err := strconv.Atoi(c.Params("commit_index"))
-	if err != nil || idx <= 0 {
-		fmt.Println(err)
+	// Commits never change, so a point in time only makes sense for branches
+	if c.Query("as_of") != "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid commit index. Must be a positive non-zero integer",
+			"error": "Query param \"as_of\" is only supported for branches; use the branch endpoints instead",
 		})
 	}
 
 	// Get project from database
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	var project models.Project
@@ -202,28 +480,61 @@ func GetOneCommit(c *fiber.Ctx) error {
 			})
 		}
 
-		fmt.Printf("[GetOneCommit] Error getting project: %v\n", err)
+		fmt.Printf("[GetCommitManifest] Error getting project: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
 	// Get commit from database
-	var result models.Commit
-	err = config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"project_id": project.ID, "index": idx}).Decode(&result)
+	commit, err := commit_lib.ResolveRef(ctx, project.ID, primitive.NilObjectID, commitRef)
 	if err == mongo.ErrNoDocuments {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Not found",
 		})
 	}
 	if err != nil {
-		fmt.Printf("[GetOneCommit] Error getting commit: %v\n", err)
+		fmt.Printf("[GetCommitManifest] Error getting commit: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	return c.JSON(result)
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, commit.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[GetCommitManifest] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Not found",
+		})
+	}
+
+	// Materialize file map, optionally limited to a path prefix
+	files, err := commit_lib.GetFiles(ctx, commit)
+	if err != nil {
+		fmt.Printf("[GetCommitManifest] Error getting commit files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if prefix := c.Query("prefix"); prefix != "" {
+		for path := range files {
+			if !strings.HasPrefix(path, prefix) {
+				delete(files, path)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"manifest_id": commit.ManifestID,
+		"files":       files,
+	})
 }
 
 // Create a new commit and update team usage metrics for billing purposes.
@@ -266,15 +577,42 @@ func CreateCommit(c *fiber.Ctx) error {
 		})
 	}
 
+	// Parse expected parent commit ID
+	parentCommitID, err := primitive.ObjectIDFromHex(reqBody.ParentCommitID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid parent commit ID; must be an ObjectID hexadecimal",
+		})
+	}
+
 	// Get branch with commit
 	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
 		fmt.Printf("[CreateCommit] Error getting branch: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	if reason := branch_lib.CommitDeniedReason(protection, acl.GetTeamRole(userData, team.ID), branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	// Make sure the client is committing on top of the current branch head
+	if branch.Commit.ID != parentCommitID {
+		return branchMovedResponse(c, branch.Commit)
+	}
+
 	// Check if any created/modified/delete file in new commit references a file locked by another user
 	combinedFiles := reqBody.CreatedFiles
 	combinedFiles = append(combinedFiles, reqBody.ModifiedFiles...)
@@ -289,32 +627,99 @@ func CreateCommit(c *fiber.Ctx) error {
 		}
 	}
 
+	// Changing or deleting files that require exclusive checkout requires holding their locks
+	existingFiles := append(append([]string{}, reqBody.ModifiedFiles...), reqBody.DeletedFiles...)
+	if unheld := lock_lib.UnheldExclusivePaths(project.ExclusiveCheckoutPatterns, branch.Locks, userData.UserID, existingFiles); len(unheld) > 0 {
+		return exclusiveCheckoutResponse(c, unheld)
+	}
+
+	// Collect file data for created and modified files
+	changedFiles := make(map[string]models.FileData, len(reqBody.CreatedFiles)+len(reqBody.ModifiedFiles))
+	for _, path := range append(append([]string{}, reqBody.CreatedFiles...), reqBody.ModifiedFiles...) {
+		data, ok := reqBody.Files[path]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Missing file data for \"%s\"", path),
+			})
+		}
+		changedFiles[path] = data
+	}
+
+	// Verify commit signature against the author's signing keys
+	var signingKeyID primitive.ObjectID
+	if reqBody.Signature != "" {
+		payload, err := signing.CanonicalCommitPayload([]primitive.ObjectID{parentCommitID}, changedFiles, reqBody.DeletedFiles, reqBody.Message)
+		if err != nil {
+			fmt.Printf("[CreateCommit] Error serializing commit for signature verification: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		cur, err := config.MI.DB.Collection("signing_keys").Find(ctx, bson.M{"user_id": userData.UserID})
+		if err != nil {
+			fmt.Printf("[CreateCommit] Error getting signing keys: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		var keys []models.SigningKey
+		if err := cur.All(ctx, &keys); err != nil {
+			fmt.Printf("[CreateCommit] Error decoding signing keys: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		for _, key := range keys {
+			if signing.Verify(key.PublicKey, payload, reqBody.Signature) {
+				signingKeyID = key.ID
+				break
+			}
+		}
+
+		if signingKeyID.IsZero() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid commit signature; it does not match any of your signing keys",
+			})
+		}
+	}
+
 	// Create commit object
 	commit := models.Commit{
 		ID:            primitive.NewObjectID(),
 		CreatedAt:     time.Now(),
-		Index:         branch.Commit.Index + 1,
 		ProjectID:     project.ID,
 		BranchID:      branch.ID,
+		ParentIDs:     []primitive.ObjectID{branch.Commit.ID},
 		Message:       reqBody.Message,
 		CreatedFiles:  reqBody.CreatedFiles,
 		ModifiedFiles: reqBody.ModifiedFiles,
 		DeletedFiles:  reqBody.DeletedFiles,
-		Files:         reqBody.Files,
+		ChangedFiles:  changedFiles,
 		AuthorID:      userData.UserID,
+		Signature:     reqBody.Signature,
+		SigningKeyID:  signingKeyID,
+		Verified:      !signingKeyID.IsZero(),
 	}
 
-	// Insert commit into database
-	if _, err = config.MI.DB.Collection("commits").InsertOne(ctx, commit); err != nil {
-		fmt.Printf("[CreateCommit] Failed to insert commit into database: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Internal server error",
-		})
-	}
+	// Insert commit and update branch to point to it
+	if err = commit_lib.Create(ctx, &commit, branch.Commit.ID, models.ReflogOperationCommit); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			// Someone else pushed to the branch while this request was in flight
+			branch, err = branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+			if err != nil {
+				fmt.Printf("[CreateCommit] Error getting moved branch: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+
+			return branchMovedResponse(c, branch.Commit)
+		}
 
-	// Update branch to point to new commit
-	if _, err = config.MI.DB.Collection("branches").UpdateOne(ctx, bson.M{"_id": branch.ID}, bson.M{"$set": bson.M{"commit_id": commit.ID}}); err != nil {
-		fmt.Printf("[CreateCommit] Failed to update branch: %v\n", err)
+		fmt.Printf("[CreateCommit] Failed to create commit: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
@@ -367,31 +772,202 @@ func CreateCommit(c *fiber.Ctx) error {
 	commit.CreatedFiles = nil
 	commit.ModifiedFiles = nil
 	commit.DeletedFiles = nil
-	commit.Files = nil
+	commit.ChangedFiles = nil
 
 	return c.JSON(commit)
 }
 
-// Update a commit.
-func UpdateCommit(c *fiber.Ctx) error {
+// Check whether a commit would conflict before the client uploads its files.
+//
+// Returns which of the given paths changed in the branch since the client's parent commit, which are locked by other
+// users, and which must be locked by the user first because they match the project's exclusive checkout patterns.
+func PrecheckCommit(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
-	commitIndex := c.Params("commit_index")
+	branchName := c.Params("branch_name")
 
 	// Parse request body
-	var commit models.Commit
-	if err := c.BodyParser(&commit); err != nil {
-		fmt.Println(err)
+	var reqBody models.PrecheckCommitRequest
+	if err := c.BodyParser(&reqBody); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	// Get project from database
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var project models.Project
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	parentCommitID, err := primitive.ObjectIDFromHex(reqBody.ParentCommitID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid parent commit ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get branch with commit
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[PrecheckCommit] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	paths := lo.Uniq(reqBody.Paths)
+
+	// Find paths that changed in the branch since the parent commit
+	changedPaths := []string{}
+	if branch.Commit.ID != parentCommitID {
+		parent, err := commit_lib.GetByID(ctx, parentCommitID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			fmt.Printf("[PrecheckCommit] Error getting parent commit: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		if err != nil || parent.ProjectID != branch.ProjectID {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Parent commit not found",
+			})
+		}
+
+		parentFiles, err := commit_lib.GetFilesAt(ctx, parent, paths)
+		if err != nil {
+			fmt.Printf("[PrecheckCommit] Error getting parent commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		headFiles, err := commit_lib.GetFilesAt(ctx, &branch.Commit, paths)
+		if err != nil {
+			fmt.Printf("[PrecheckCommit] Error getting head commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		for _, path := range paths {
+			before, inParent := parentFiles[path]
+			after, inHead := headFiles[path]
+			if inParent != inHead || (inParent && !manifest_lib.FileDataEqual(before, after)) {
+				changedPaths = append(changedPaths, path)
+			}
+		}
+	}
+
+	// Find paths locked by other users
+	lockedPaths := make(map[string]string)
+	for _, path := range paths {
+		if lockedBy, ok := branch.Locks[path]; ok && lockedBy != userData.UserID {
+			lockedPaths[path] = lockedBy
+		}
+	}
+
+	// Find existing paths that require exclusive checkout but aren't locked by anyone
+	unlockedPaths := []string{}
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"_id": branch.ProjectID}).Decode(&project); err != nil {
+		fmt.Printf("[PrecheckCommit] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if exclusivePaths := lo.Filter(lock_lib.UnheldExclusivePaths(project.ExclusiveCheckoutPatterns, branch.Locks, userData.UserID, paths), func(path string, _ int) bool {
+		_, lockedByOther := lockedPaths[path]
+		return !lockedByOther
+	}); len(exclusivePaths) > 0 {
+		headFiles, err := commit_lib.GetFilesAt(ctx, &branch.Commit, exclusivePaths)
+		if err != nil {
+			fmt.Printf("[PrecheckCommit] Error getting head commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		for _, path := range exclusivePaths {
+			if _, ok := headFiles[path]; ok {
+				unlockedPaths = append(unlockedPaths, path)
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"head": fiber.Map{
+			"_id":   branch.Commit.ID,
+			"index": branch.Commit.Index,
+		},
+		"up_to_date":     branch.Commit.ID == parentCommitID,
+		"changed_paths":  changedPaths,
+		"locked_paths":   lockedPaths,
+		"unlocked_paths": unlockedPaths,
+		"ok":             len(changedPaths) == 0 && len(lockedPaths) == 0 && len(unlockedPaths) == 0,
+	})
+}
+
+// Respond with 403 Forbidden and the files that the user must lock before changing them, because they match the
+// project's exclusive checkout patterns.
+func exclusiveCheckoutResponse(c *fiber.Ctx, paths []string) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": fmt.Sprintf("File \"%s\" requires exclusive checkout; lock it before changing it", paths[0]),
+		"paths": paths,
+	})
+}
+
+// Respond with 409 Conflict and the branch's current head commit.
+func branchMovedResponse(c *fiber.Ctx, head models.Commit) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error": "Branch has moved since the parent commit; pull the latest changes and try again",
+		"head": fiber.Map{
+			"_id":   head.ID.Hex(),
+			"index": head.Index,
+		},
+	})
+}
+
+// Update a commit by index or tag name. Only the message can be changed.
+//
+// Since signatures cover the message, changing the message of a signed commit removes its signature.
+func UpdateCommit(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	commitRef := c.Params("commit_index")
+
+	// Parse request body
+	var reqBody models.UpdateCommitRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
 	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -405,8 +981,43 @@ func UpdateCommit(c *fiber.Ctx) error {
 		})
 	}
 
+	// Get commit from database
+	existingCommit, err := commit_lib.ResolveRef(ctx, project.ID, primitive.NilObjectID, commitRef)
+	if err == mongo.ErrNoDocuments {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Commit not found",
+		})
+	}
+	if err != nil {
+		fmt.Printf("[UpdateCommit] Error getting commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, existingCommit.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[UpdateCommit] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Commit not found",
+		})
+	}
+
 	// Update commit in database
-	if _, err := config.MI.DB.Collection("commits").UpdateOne(ctx, bson.M{"project_id": project.ID, "index": commitIndex}, bson.M{"$set": commit}); err != nil {
+	update := bson.M{"$set": bson.M{"message": reqBody.Message}}
+	if reqBody.Message != existingCommit.Message && existingCommit.Signature != "" {
+		update = bson.M{
+			"$set":   bson.M{"message": reqBody.Message, "verified": false},
+			"$unset": bson.M{"signature": "", "signing_key_id": ""},
+		}
+	}
+	if _, err := config.MI.DB.Collection("commits").UpdateOne(ctx, bson.M{"_id": existingCommit.ID}, update); err != nil {
 		fmt.Printf("[UpdateCommit] Error updating commit: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
@@ -419,7 +1030,10 @@ func UpdateCommit(c *fiber.Ctx) error {
 }
 
 // Delete many commits after the specified index in the specified branch.
+//
+// Deleted commits are kept for the retention period, during which they can be restored from the branch's reflog.
 func DeleteManyCommitsInBranch(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 	branchName := c.Params("branch_name")
@@ -452,7 +1066,7 @@ func DeleteManyCommitsInBranch(c *fiber.Ctx) error {
 
 	// Get branch from database
 	var branch models.Branch
-	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{"project_id": project.ID, "name": branchName}).Decode(&branch); err != nil {
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{"project_id": project.ID, "name": branchName, "deleted_at": bson.M{"$exists": false}}).Decode(&branch); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Branch not found",
@@ -465,26 +1079,58 @@ func DeleteManyCommitsInBranch(c *fiber.Ctx) error {
 		})
 	}
 
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	if reason := branch_lib.RewriteDeniedReason(protection, acl.GetTeamRole(userData, team.ID), branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
 	// Get commit with index
-	var afterCommit models.Commit
-	if err = config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"branch_id": branch.ID, "index": after}).Decode(&afterCommit); err != nil {
+	afterCommit, err := commit_lib.GetByIndexInBranch(ctx, project.ID, branch.ID, after)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d not found", after),
+			})
+		}
+
 		fmt.Printf("[DeleteManyCommitsInBranch] Error getting commit with index: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	// Update branch to point to commit with specified index
-	if _, err := config.MI.DB.Collection("branches").UpdateOne(ctx, bson.M{"_id": branch.ID}, bson.M{"$set": bson.M{"commit_id": afterCommit.ID}}); err != nil {
-		fmt.Printf("[DeleteManyCommitsInBranch] Error updating branch: %v\n", err)
+	// Make sure the commit is part of the branch's history
+	if _, err := commit_lib.GetHistoryUntil(ctx, branch.CommitID, afterCommit.ID); err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d is not in the history of branch \"%s\"", afterCommit.Index, branch.Name),
+			})
+		}
+
+		fmt.Printf("[DeleteManyCommitsInBranch] Error walking branch history: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	// Delete commits after specified index
-	if _, err := config.MI.DB.Collection("commits").DeleteMany(ctx, bson.M{"branch_id": branch.ID, "index": bson.M{"$gt": after}}); err != nil {
-		fmt.Printf("[DeleteManyCommitsInBranch] Error deleting many commits after: %v\n", err)
+	// Update branch to point to commit with specified index.
+	// Commits after it are soft-deleted so they can be restored from the reflog until they're purged.
+	entry := models.ReflogEntry{
+		ProjectID: project.ID,
+		UserID:    userData.UserID,
+		Operation: models.ReflogOperationReset,
+	}
+	if err := commit_lib.Reset(ctx, branch.ID, branch.CommitID, afterCommit, &entry); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Branch has moved; please try again",
+			})
+		}
+
+		fmt.Printf("[DeleteManyCommitsInBranch] Error resetting branch: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
@@ -494,3 +1140,1304 @@ func DeleteManyCommitsInBranch(c *fiber.Ctx) error {
 		"message": "Deleted commits successfully",
 	})
 }
+
+// Revert one commit or a range of commits in the specified branch.
+//
+// Creates a new commit on top of the branch that restores the affected paths to their state before the reverted
+// commits, so that history is preserved.
+func RevertCommits(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Parse request body
+	var reqBody models.RevertCommitsRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if reqBody.ToIndex == 0 {
+		reqBody.ToIndex = reqBody.FromIndex
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch with commit
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	if reason := branch_lib.CommitDeniedReason(protection, acl.GetTeamRole(userData, team.ID), branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	// Get first and last commits to revert
+	fromCommit, err := commit_lib.GetByIndexInBranch(ctx, project.ID, branch.ID, reqBody.FromIndex)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d not found", reqBody.FromIndex),
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error getting first commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	toCommit, err := commit_lib.GetByIndexInBranch(ctx, project.ID, branch.ID, reqBody.ToIndex)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d not found", reqBody.ToIndex),
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error getting last commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if len(fromCommit.ParentIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot revert the initial commit of a project",
+		})
+	}
+
+	// Make sure the range is part of the branch's history
+	if _, err := commit_lib.GetHistoryUntil(ctx, branch.Commit.ID, toCommit.ID); err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d is not in the history of branch \"%s\"", toCommit.Index, branch.Name),
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error walking branch history: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	revertedCommits, err := commit_lib.GetHistoryUntil(ctx, toCommit.ID, fromCommit.ID)
+	if err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d is not an ancestor of commit #%d", fromCommit.Index, toCommit.Index),
+			})
+		}
+
+		fmt.Printf("[RevertCommits] Error walking commit range: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get the state of the files before the reverted commits
+	priorCommit, err := commit_lib.GetByID(ctx, fromCommit.ParentIDs[0])
+	if err != nil {
+		fmt.Printf("[RevertCommits] Error getting parent of first reverted commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Collect every path touched by the reverted commits
+	var revertedCommitIDs []primitive.ObjectID
+	var affectedPaths []string
+	for _, revertedCommit := range revertedCommits {
+		revertedCommitIDs = append(revertedCommitIDs, revertedCommit.ID)
+		affectedPaths = append(affectedPaths, commit_lib.ChangedPaths(revertedCommit)...)
+	}
+	affectedPaths = lo.Uniq(affectedPaths)
+
+	// Get the prior and current file data for the affected paths
+	priorFiles, err := commit_lib.GetFilesAt(ctx, priorCommit, affectedPaths)
+	if err != nil {
+		fmt.Printf("[RevertCommits] Error getting prior files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	currentFiles, err := commit_lib.GetFilesAt(ctx, &branch.Commit, affectedPaths)
+	if err != nil {
+		fmt.Printf("[RevertCommits] Error getting current files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Restore the prior file data for every affected path
+	var createdFiles, modifiedFiles, deletedFiles []string
+	changedFiles := make(map[string]models.FileData)
+	for _, path := range affectedPaths {
+		prior, existedBefore := priorFiles[path]
+		current, existsNow := currentFiles[path]
+		if existedBefore {
+			if !existsNow {
+				createdFiles = append(createdFiles, path)
+			} else if !manifest_lib.FileDataEqual(prior, current) {
+				modifiedFiles = append(modifiedFiles, path)
+			} else {
+				continue
+			}
+			changedFiles[path] = prior
+		} else if existsNow {
+			deletedFiles = append(deletedFiles, path)
+		}
+	}
+
+	if len(createdFiles)+len(modifiedFiles)+len(deletedFiles) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to revert; the affected files already match their prior state",
+		})
+	}
+
+	// Check if any reverted file is locked by another user
+	combinedFiles := append(append(append([]string{}, createdFiles...), modifiedFiles...), deletedFiles...)
+	for _, path := range combinedFiles {
+		if lockedBy, ok := branch.Locks[path]; ok && lockedBy != userData.UserID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("File \"%s\" is locked by %s", path, lockedBy),
+			})
+		}
+	}
+	existingFiles := append(append([]string{}, modifiedFiles...), deletedFiles...)
+	if unheld := lock_lib.UnheldExclusivePaths(project.ExclusiveCheckoutPatterns, branch.Locks, userData.UserID, existingFiles); len(unheld) > 0 {
+		return exclusiveCheckoutResponse(c, unheld)
+	}
+
+	// Create revert commit
+	message := reqBody.Message
+	if message == "" {
+		if fromCommit.ID == toCommit.ID {
+			message = fmt.Sprintf("Revert #%d \"%s\"", fromCommit.Index, fromCommit.Message)
+		} else {
+			message = fmt.Sprintf("Revert #%d through #%d", fromCommit.Index, toCommit.Index)
+		}
+	}
+
+	commit := models.Commit{
+		ID:                primitive.NewObjectID(),
+		CreatedAt:         time.Now(),
+		ProjectID:         project.ID,
+		BranchID:          branch.ID,
+		ParentIDs:         []primitive.ObjectID{branch.Commit.ID},
+		Message:           message,
+		CreatedFiles:      createdFiles,
+		ModifiedFiles:     modifiedFiles,
+		DeletedFiles:      deletedFiles,
+		ChangedFiles:      changedFiles,
+		AuthorID:          userData.UserID,
+		RevertedCommitIDs: revertedCommitIDs,
+	}
+
+	if err = commit_lib.Create(ctx, &commit, branch.Commit.ID, models.ReflogOperationRevert); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			branch, err = branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+			if err != nil {
+				fmt.Printf("[RevertCommits] Error getting moved branch: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+
+			return branchMovedResponse(c, branch.Commit)
+		}
+
+		fmt.Printf("[RevertCommits] Failed to create revert commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Omit large fields to prevent memory issues
+	commit.ChangedFiles = nil
+
+	return c.JSON(commit)
+}
+
+// Apply the file changes of one or many commits from another branch onto the specified branch as new commits.
+//
+// If the target branch's version of a touched path differs from the version the picked commit was based on, nothing
+// is applied and the conflicting paths are returned instead. The new commits are written and the branch is moved to
+// the last one in a single transaction, so either all of them are applied or none.
+func CherryPickCommits(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Parse request body
+	var reqBody models.CherryPickRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if reqBody.SourceBranch == branchName {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Source and target branches must be different",
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[CherryPickCommits] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get target and source branches with their commits
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[CherryPickCommits] Error getting target branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	if reason := branch_lib.CommitDeniedReason(protection, acl.GetTeamRole(userData, team.ID), branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	sourceBranch, err := branch_lib.GetOneWithCommit(team.ID, projectName, reqBody.SourceBranch)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Source branch not found",
+			})
+		}
+
+		fmt.Printf("[CherryPickCommits] Error getting source branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !branch_lib.CanAccess(sourceBranch.Visibility, sourceBranch.OwnerID, userData, team.ID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Source branch not found",
+		})
+	}
+
+	// Get commits to pick in the order they were made
+	indexes := lo.Uniq(reqBody.CommitIndexes)
+	sort.Ints(indexes)
+
+	var pickedCommits []*models.Commit
+	var touchedPaths []string
+	for _, index := range indexes {
+		picked, err := commit_lib.GetByIndexInBranch(ctx, project.ID, sourceBranch.ID, index)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": fmt.Sprintf("Commit #%d not found", index),
+				})
+			}
+
+			fmt.Printf("[CherryPickCommits] Error getting commit: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		if len(picked.ParentIDs) == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Cannot cherry-pick the initial commit of a project",
+			})
+		}
+
+		// Make sure the commit is part of the source branch's history
+		if _, err := commit_lib.GetHistoryUntil(ctx, sourceBranch.Commit.ID, picked.ID); err != nil {
+			if errors.Is(err, commit_lib.ErrNotInHistory) {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Commit #%d is not in the history of branch \"%s\"", picked.Index, sourceBranch.Name),
+				})
+			}
+
+			fmt.Printf("[CherryPickCommits] Error walking source branch history: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		pickedCommits = append(pickedCommits, picked)
+		touchedPaths = append(touchedPaths, commit_lib.ChangedPaths(*picked)...)
+	}
+	touchedPaths = lo.Uniq(touchedPaths)
+
+	// Get the target branch's current file data for all touched paths
+	files, err := commit_lib.GetFilesAt(ctx, &branch.Commit, touchedPaths)
+	if err != nil {
+		fmt.Printf("[CherryPickCommits] Error getting target branch files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Apply commits on top of each other
+	var newCommits []models.Commit
+	var conflicts []models.CherryPickConflict
+	for _, picked := range pickedCommits {
+		paths := lo.Uniq(commit_lib.ChangedPaths(*picked))
+
+		parent, err := commit_lib.GetByID(ctx, picked.ParentIDs[0])
+		if err != nil {
+			fmt.Printf("[CherryPickCommits] Error getting parent commit: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		baseFiles, err := commit_lib.GetFilesAt(ctx, parent, paths)
+		if err != nil {
+			fmt.Printf("[CherryPickCommits] Error getting parent commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		resultFiles, err := commit_lib.GetFilesAt(ctx, picked, paths)
+		if err != nil {
+			fmt.Printf("[CherryPickCommits] Error getting picked commit files: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		var createdFiles, modifiedFiles, deletedFiles []string
+		changedFiles := make(map[string]models.FileData)
+		for _, path := range paths {
+			base, inBase := baseFiles[path]
+			result, inResult := resultFiles[path]
+			current, inTarget := files[path]
+
+			// Skip paths that already match the picked result
+			if inResult == inTarget && (!inResult || manifest_lib.FileDataEqual(result, current)) {
+				continue
+			}
+
+			// Target must still have the version the picked commit was based on
+			if inBase != inTarget || (inBase && !manifest_lib.FileDataEqual(base, current)) {
+				conflicts = append(conflicts, models.CherryPickConflict{CommitIndex: picked.Index, Path: path})
+				continue
+			}
+
+			if inResult {
+				if inTarget {
+					modifiedFiles = append(modifiedFiles, path)
+				} else {
+					createdFiles = append(createdFiles, path)
+				}
+				changedFiles[path] = result
+				files[path] = result
+			} else {
+				deletedFiles = append(deletedFiles, path)
+				delete(files, path)
+			}
+		}
+
+		if len(createdFiles)+len(modifiedFiles)+len(deletedFiles) == 0 {
+			// Changes are already present in the target branch
+			continue
+		}
+
+		newCommits = append(newCommits, models.Commit{
+			ID:                 primitive.NewObjectID(),
+			ProjectID:          project.ID,
+			BranchID:           branch.ID,
+			Message:            picked.Message,
+			CreatedFiles:       createdFiles,
+			ModifiedFiles:      modifiedFiles,
+			DeletedFiles:       deletedFiles,
+			ChangedFiles:       changedFiles,
+			AuthorID:           userData.UserID,
+			CherryPickedFromID: picked.ID,
+		})
+	}
+
+	if len(conflicts) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":     "Some paths were changed in the target branch since the picked commits were made",
+			"conflicts": conflicts,
+		})
+	}
+
+	if len(newCommits) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Nothing to cherry-pick; the changes are already present in the target branch",
+		})
+	}
+
+	// Check if any touched file is locked by another user
+	for _, commit := range newCommits {
+		for _, path := range commit_lib.ChangedPaths(commit) {
+			if lockedBy, ok := branch.Locks[path]; ok && lockedBy != userData.UserID {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("File \"%s\" is locked by %s", path, lockedBy),
+				})
+			}
+		}
+
+		existingFiles := append(append([]string{}, commit.ModifiedFiles...), commit.DeletedFiles...)
+		if unheld := lock_lib.UnheldExclusivePaths(project.ExclusiveCheckoutPatterns, branch.Locks, userData.UserID, existingFiles); len(unheld) > 0 {
+			return exclusiveCheckoutResponse(c, unheld)
+		}
+	}
+
+	// Build the commits on top of each other, so that they can all be written in one transaction
+	now := time.Now()
+	manifestID := branch.Commit.ManifestID
+	parentID := branch.Commit.ID
+	writtenCommits := make([]*models.Commit, len(newCommits))
+	for i := range newCommits {
+		manifestID, err = manifest_lib.Apply(ctx, manifestID, newCommits[i].ChangedFiles, newCommits[i].DeletedFiles)
+		if err != nil {
+			fmt.Printf("[CherryPickCommits] Error building manifest: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		newCommits[i].CreatedAt = now
+		newCommits[i].ParentIDs = []primitive.ObjectID{parentID}
+		newCommits[i].ManifestID = manifestID
+		writtenCommits[i] = &newCommits[i]
+		parentID = newCommits[i].ID
+	}
+
+	entry := models.ReflogEntry{
+		ProjectID: project.ID,
+		UserID:    userData.UserID,
+		Operation: models.ReflogOperationCherryPick,
+	}
+	if err = commit_lib.Rewrite(ctx, branch.ID, branch.Commit.ID, writtenCommits, nil, &entry); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			branch, err = branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+			if err != nil {
+				fmt.Printf("[CherryPickCommits] Error getting moved branch: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+
+			return branchMovedResponse(c, branch.Commit)
+		}
+
+		fmt.Printf("[CherryPickCommits] Failed to create commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Omit large fields to prevent memory issues
+	for i := range newCommits {
+		newCommits[i].ChangedFiles = nil
+	}
+
+	return c.JSON(newCommits)
+}
+
+// Squash a contiguous range of commits in the specified branch into a single commit.
+//
+// The squashed commit has the final file state of the range. Commits made after the range are recreated on top of it.
+// The original commits are soft-deleted and recorded in the reflog so that they can be recovered.
+//
+// Only admins can squash commits in protected branches.
+func SquashCommits(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Parse request body
+	var reqBody models.SquashCommitsRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[SquashCommits] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch with commit
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[SquashCommits] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	role := acl.GetTeamRole(userData, team.ID)
+	if reason := branch_lib.RewriteDeniedReason(protection, role, branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+	if reason := branch_lib.CommitDeniedReason(protection, role, branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	// Get first commit to squash
+	fromCommit, err := commit_lib.GetByIndexInBranch(ctx, project.ID, branch.ID, reqBody.FromIndex)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d not found", reqBody.FromIndex),
+			})
+		}
+
+		fmt.Printf("[SquashCommits] Error getting first commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if len(fromCommit.ParentIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot squash the initial commit of a project",
+		})
+	}
+
+	// Get last commit to squash
+	lastCommit, err := commit_lib.GetByIndexInBranch(ctx, project.ID, branch.ID, reqBody.ToIndex)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d not found", reqBody.ToIndex),
+			})
+		}
+
+		fmt.Printf("[SquashCommits] Error getting last commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch history back to the first commit, newest first
+	history, err := commit_lib.GetHistoryUntil(ctx, branch.Commit.ID, fromCommit.ID)
+	if err != nil {
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Commit #%d is not in the history of branch \"%s\"", fromCommit.Index, branch.Name),
+			})
+		}
+
+		fmt.Printf("[SquashCommits] Error walking branch history: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Split history into commits made after the range, and the range itself
+	toPos := -1
+	for i, commit := range history {
+		if commit.ID == lastCommit.ID {
+			toPos = i
+			break
+		}
+	}
+	if toPos == -1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Commit #%d is not between commit #%d and the head of branch \"%s\"", lastCommit.Index, fromCommit.Index, branch.Name),
+		})
+	}
+
+	laterCommits := lo.Reverse(append([]models.Commit{}, history[:toPos]...))
+	squashedCommits := lo.Reverse(append([]models.Commit{}, history[toPos:]...))
+	toCommit := squashedCommits[len(squashedCommits)-1]
+
+	// Get the state of the files before and after the range
+	var affectedPaths []string
+	for _, commit := range squashedCommits {
+		affectedPaths = append(affectedPaths, commit_lib.ChangedPaths(commit)...)
+	}
+	affectedPaths = lo.Uniq(affectedPaths)
+
+	baseCommit, err := commit_lib.GetByID(ctx, fromCommit.ParentIDs[0])
+	if err != nil {
+		fmt.Printf("[SquashCommits] Error getting parent of first squashed commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	baseFiles, err := commit_lib.GetFilesAt(ctx, baseCommit, affectedPaths)
+	if err != nil {
+		fmt.Printf("[SquashCommits] Error getting base files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	finalFiles, err := commit_lib.GetFilesAt(ctx, &toCommit, affectedPaths)
+	if err != nil {
+		fmt.Printf("[SquashCommits] Error getting final files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Collapse the changes of the range
+	var createdFiles, modifiedFiles, deletedFiles []string
+	changedFiles := make(map[string]models.FileData)
+	for _, path := range affectedPaths {
+		base, inBase := baseFiles[path]
+		final, inFinal := finalFiles[path]
+		if inFinal {
+			if !inBase {
+				createdFiles = append(createdFiles, path)
+			} else if !manifest_lib.FileDataEqual(base, final) {
+				modifiedFiles = append(modifiedFiles, path)
+			} else {
+				continue
+			}
+			changedFiles[path] = final
+		} else if inBase {
+			deletedFiles = append(deletedFiles, path)
+		}
+	}
+	if len(createdFiles) == 0 && len(modifiedFiles) == 0 && len(deletedFiles) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The commits to squash have no net changes",
+		})
+	}
+
+	message := reqBody.Message
+	if message == "" {
+		message = strings.Join(lo.Map(squashedCommits, func(commit models.Commit, _ int) string {
+			return commit.Message
+		}), "\n")
+	}
+
+	now := time.Now()
+	squashCommit := models.Commit{
+		ID:            primitive.NewObjectID(),
+		CreatedAt:     now,
+		ProjectID:     project.ID,
+		BranchID:      branch.ID,
+		ParentIDs:     []primitive.ObjectID{baseCommit.ID},
+		Message:       message,
+		CreatedFiles:  createdFiles,
+		ModifiedFiles: modifiedFiles,
+		DeletedFiles:  deletedFiles,
+		ManifestID:    toCommit.ManifestID,
+		ChangedFiles:  changedFiles,
+		AuthorID:      userData.UserID,
+	}
+	newCommits := []*models.Commit{&squashCommit}
+	replacedIDs := lo.Map(squashedCommits, func(commit models.Commit, _ int) primitive.ObjectID { return commit.ID })
+
+	// Recreate commits made after the range on top of the squashed commit.
+	// Their file states are unchanged, but signatures no longer apply since their parents changed.
+	parentID := squashCommit.ID
+	for _, later := range laterCommits {
+		full, err := commit_lib.GetByID(ctx, later.ID)
+		if err != nil {
+			fmt.Printf("[SquashCommits] Error getting later commit: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		recreated := *full
+		recreated.ID = primitive.NewObjectID()
+		recreated.CreatedAt = now
+		recreated.ParentIDs = append([]primitive.ObjectID{parentID}, full.ParentIDs[1:]...)
+		if protection.RequireLinearHistory && len(recreated.ParentIDs) > 1 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": fmt.Sprintf("Branch \"%s\" requires a linear history; cannot recreate merge commit #%d", branch.Name, full.Index),
+			})
+		}
+		recreated.LegacyIndex = 0
+		recreated.Signature = ""
+		recreated.SigningKeyID = primitive.NilObjectID
+		recreated.Verified = false
+		newCommits = append(newCommits, &recreated)
+		replacedIDs = append(replacedIDs, full.ID)
+		parentID = recreated.ID
+	}
+
+	entry := models.ReflogEntry{
+		ProjectID: project.ID,
+		UserID:    userData.UserID,
+		Operation: models.ReflogOperationSquash,
+	}
+	if err = commit_lib.Rewrite(ctx, branch.ID, branch.Commit.ID, newCommits, replacedIDs, &entry); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			branch, err = branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+			if err != nil {
+				fmt.Printf("[SquashCommits] Error getting moved branch: %v\n", err)
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Internal server error",
+				})
+			}
+
+			return branchMovedResponse(c, branch.Commit)
+		}
+
+		fmt.Printf("[SquashCommits] Failed to squash commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Omit large fields to prevent memory issues
+	result := make([]models.Commit, len(newCommits))
+	for i, commit := range newCommits {
+		commit.ChangedFiles = nil
+		result[i] = *commit
+	}
+
+	return c.JSON(result)
+}
+
+// Get the net file changes between a known commit and the head of the specified branch, so that clients can sync
+// without fetching every commit in between. Each changed path is returned once with its final file data.
+//
+// Query params:
+//   - "since": Index or tag name of the commit the client currently has (required)
+//   - "as_of": RFC 3339 timestamp; if set, uses the commit the branch pointed to at that time as the head
+func GetBranchChanges(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	sinceRef := c.Query("since")
+	if sinceRef == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Missing query param \"since\"",
+		})
+	}
+
+	// Get "as_of" query param
+	asOf, err := parseAsOf(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid query param \"as_of\"; must be an RFC 3339 timestamp",
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchChanges] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch with commit
+	branch, err := branch_lib.GetOneWithCommit(team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchChanges] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if asOf != nil {
+		if err := setCommitAsOf(ctx, branch, *asOf); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": "Branch did not exist at that time",
+				})
+			}
+
+			fmt.Printf("[GetBranchChanges] Error getting commit as of time: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	// Get the client's commit
+	sinceCommit, err := commit_lib.ResolveRef(ctx, project.ID, branch.ID, sinceRef)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Commit not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchChanges] Error getting commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, sinceCommit.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[GetBranchChanges] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Commit not found",
+		})
+	}
+
+	// Diff manifests.
+	// This works even if the client's commit isn't an ancestor of the head (e.g. after the branch was reset).
+	diff, err := manifest_lib.Diff(ctx, sinceCommit.ManifestID, branch.Commit.ManifestID)
+	if err != nil {
+		fmt.Printf("[GetBranchChanges] Error diffing manifests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"since": fiber.Map{
+			"_id":   sinceCommit.ID,
+			"index": sinceCommit.Index,
+		},
+		"head": fiber.Map{
+			"_id":   branch.Commit.ID,
+			"index": branch.Commit.Index,
+		},
+		"created":  diff.Created,
+		"modified": diff.Modified,
+		"deleted":  diff.Deleted,
+	})
+}
+
+// Get a page of the commit graph of a project, newest first, for drawing history with branch and merge lanes.
+//
+// Query params (all optional):
+//   - "branches": Comma-separated names of the branches to include (default: all branches)
+//   - "limit": Max number of commits to return (default 50, max 200)
+//   - "cursor": Cursor from the "X-Next-Cursor" header of a previous response
+func GetCommitGraph(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Get limit query param
+	limit, err := strconv.ParseInt(c.Query("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	// Get cursor
+	var cursor *graph_lib.Cursor
+	if token := c.Query("cursor"); token != "" {
+		decoded, err := graph_lib.DecodeCursor(token)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid cursor",
+			})
+		}
+		cursor = &decoded
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetCommitGraph] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get selected branches
+	branchFilter := bson.M{
+		"project_id": project.ID,
+		"deleted_at": bson.M{"$exists": false},
+		"$and":       []bson.M{branch_lib.AccessFilter(userData, team.ID)},
+	}
+	var branchNames []string
+	if val := c.Query("branches"); val != "" {
+		branchNames = lo.Uniq(strings.Split(val, ","))
+		branchFilter["name"] = bson.M{"$in": branchNames}
+	}
+
+	cur, err := config.MI.DB.Collection("branches").Find(ctx, branchFilter)
+	if err != nil {
+		fmt.Printf("[GetCommitGraph] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var branches []models.Branch
+	if err := cur.All(ctx, &branches); err != nil {
+		fmt.Printf("[GetCommitGraph] Error decoding branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if branchNames != nil && len(branches) != len(branchNames) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "One or more branches not found",
+		})
+	}
+
+	branchIDs := lo.Map(branches, func(branch models.Branch, _ int) primitive.ObjectID { return branch.ID })
+
+	// Get page of commits made in the selected branches
+	filter := bson.M{
+		"project_id": project.ID,
+		"branch_id":  bson.M{"$in": branchIDs},
+		"deleted_at": bson.M{"$exists": false},
+	}
+	var lanes []primitive.ObjectID
+	if cursor != nil {
+		filter = bson.M{"$and": bson.A{filter, cursor.Position.Filter()}}
+		lanes = cursor.Lanes
+	}
+
+	cur, err = config.MI.DB.Collection("commits").Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(limit+1).
+			SetProjection(bson.M{"_id": 1, "created_at": 1, "index": 1, "branch_id": 1, "message": 1, "author_id": 1, "parent_ids": 1}),
+	)
+	if err != nil {
+		fmt.Printf("[GetCommitGraph] Error getting commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var commits []models.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		fmt.Printf("[GetCommitGraph] Error decoding commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	hasMore := int64(len(commits)) > limit
+	if hasMore {
+		commits = commits[:limit]
+	}
+
+	// Find which parents are part of the graph
+	var parentIDs []primitive.ObjectID
+	for _, commit := range commits {
+		parentIDs = append(parentIDs, commit.ParentIDs...)
+	}
+	inGraph := make(map[primitive.ObjectID]bool)
+	if len(parentIDs) > 0 {
+		ids, err := config.MI.DB.Collection("commits").Distinct(ctx, "_id", bson.M{
+			"_id":        bson.M{"$in": lo.Uniq(parentIDs)},
+			"branch_id":  bson.M{"$in": branchIDs},
+			"deleted_at": bson.M{"$exists": false},
+		})
+		if err != nil {
+			fmt.Printf("[GetCommitGraph] Error getting parent commits: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		for _, id := range ids {
+			if oid, ok := id.(primitive.ObjectID); ok {
+				inGraph[oid] = true
+			}
+		}
+	}
+
+	nodes, lanes := graph_lib.AssignLanes(commits, inGraph, lanes)
+
+	// Add branch and tag labels
+	commitIDs := lo.Map(commits, func(commit models.Commit, _ int) primitive.ObjectID { return commit.ID })
+	branchLabels := make(map[primitive.ObjectID][]string)
+	for _, branch := range branches {
+		branchLabels[branch.CommitID] = append(branchLabels[branch.CommitID], branch.Name)
+	}
+
+	tagLabels := make(map[primitive.ObjectID][]string)
+	cur, err = config.MI.DB.Collection("tags").Find(ctx, bson.M{"project_id": project.ID, "commit_id": bson.M{"$in": commitIDs}})
+	if err != nil {
+		fmt.Printf("[GetCommitGraph] Error getting tags: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var tags []models.Tag
+	if err := cur.All(ctx, &tags); err != nil {
+		fmt.Printf("[GetCommitGraph] Error decoding tags: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	for _, tag := range tags {
+		tagLabels[tag.CommitID] = append(tagLabels[tag.CommitID], tag.Name)
+	}
+
+	for i := range nodes {
+		nodes[i].Branches = branchLabels[nodes[i].ID]
+		nodes[i].Tags = tagLabels[nodes[i].ID]
+	}
+
+	if hasMore {
+		last := commits[len(commits)-1]
+		c.Set("X-Next-Cursor", graph_lib.EncodeCursor(graph_lib.Cursor{
+			Position: commit_lib.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+			Lanes:    lanes,
+		}))
+	}
+
+	return c.JSON(nodes)
+}
+
+// Search commits in a project by message, author, creation date range, and touched path.
+//
+// Query params (all optional):
+//   - "q": Full-text search over commit messages
+//   - "author_id": ID of the commit author
+//   - "since"/"until": RFC 3339 timestamps bounding the commit creation date (inclusive)
+//   - "path": File path or path prefix that the commit created, modified, or deleted
+//   - "limit": Max number of commits to return (default 25, max 100)
+func SearchCommits(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Get limit query param
+	limit, err := strconv.ParseInt(c.Query("limit", "25"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 25
+	}
+	if limit > 100 {
+		limit = 100
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[SearchCommits] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Build bson filter
+	filter := bson.M{"project_id": project.ID, "deleted_at": bson.M{"$exists": false}}
+
+	// Hide commits of private branches the user can't access
+	inaccessibleIDs, err := branch_lib.InaccessibleIDs(ctx, project.ID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[SearchCommits] Error getting inaccessible branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if len(inaccessibleIDs) > 0 {
+		filter["branch_id"] = bson.M{"$nin": inaccessibleIDs}
+	}
+
+	if q := c.Query("q"); q != "" {
+		filter["$text"] = bson.M{"$search": q}
+	}
+
+	if authorID := c.Query("author_id"); authorID != "" {
+		filter["author_id"] = authorID
+	}
+
+	createdAt := bson.M{}
+	for param, op := range map[string]string{"since": "$gte", "until": "$lte"} {
+		if val := c.Query(param); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": fmt.Sprintf("Invalid query param \"%s\"; must be an RFC 3339 timestamp", param),
+				})
+			}
+			createdAt[op] = t
+		}
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+
+	if path := c.Query("path"); path != "" {
+		// Anchored regex so the path indexes can be used for prefix matching
+		pathFilter := bson.M{"$regex": "^" + regexp.QuoteMeta(path)}
+		filter["$or"] = []bson.M{
+			{"created_files": pathFilter},
+			{"modified_files": pathFilter},
+			{"deleted_files": pathFilter},
+		}
+	}
+
+	// Get commits from database
+	cur, err := config.MI.DB.Collection("commits").Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(limit).
+			SetProjection(bson.M{"changed_files": 0}),
+	)
+	if err != nil {
+		fmt.Printf("[SearchCommits] Error searching commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.Commit
+	if err := cur.All(ctx, &result); err != nil {
+		fmt.Printf("[SearchCommits] Error decoding commits: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if result == nil {
+		result = []models.Commit{}
+	}
+
+	return c.JSON(result)
+}
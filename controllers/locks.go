@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strings"
 	"time"
 
@@ -11,12 +13,18 @@ import (
 	"github.com/decentvcs/server/lib/acl"
 	"github.com/decentvcs/server/lib/auth"
 	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/email"
+	"github.com/decentvcs/server/lib/events"
+	"github.com/decentvcs/server/lib/lock_lib"
 	"github.com/decentvcs/server/lib/team_lib"
 	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/samber/lo"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Lock one or many files from edits by other users.
@@ -59,23 +67,51 @@ func Lock(c *fiber.Ctx) error {
 		})
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get project for its exclusive checkout patterns and default lock TTL
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"_id": branch.ProjectID}).Decode(&project); err != nil {
+		fmt.Printf("[Lock] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get committed files of branch head
+	files, err := commit_lib.GetFiles(ctx, &branch.Commit)
+	if err != nil {
+		fmt.Printf("[Lock] Error getting branch files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
 	var filePaths []string
 	for _, path := range reqBody.Paths {
 		// Make sure path exists in branch remote
-		if _, ok := branch.Commit.Files[path]; ok {
+		if _, ok := files[path]; ok {
 			// File path exists
 			filePaths = append(filePaths, path)
 		} else {
 			// File path does not exist in branch remote, check if path is a directory
 			found := false
-			for _, key := range lo.Keys(branch.Commit.Files) {
+			dir := strings.TrimSuffix(path, "/") + "/"
+			for _, key := range lo.Keys(files) {
 				// Path is a directory, add all committed files in directory
-				if strings.HasPrefix(key, path) {
+				if key == path || strings.HasPrefix(key, dir) {
 					filePaths = append(filePaths, key)
 					found = true
 				}
 			}
 
+			// Files that require exclusive checkout can be locked before they're committed
+			if !found && lock_lib.RequiresExclusiveCheckout(project.ExclusiveCheckoutPatterns, path) {
+				filePaths = append(filePaths, path)
+				found = true
+			}
+
 			if !found {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 					"error":   "Bad request",
@@ -85,50 +121,68 @@ func Lock(c *fiber.Ctx) error {
 		}
 	}
 
-	locks := make(map[string]string)
-	if branch.Locks != nil {
-		locks = branch.Locks
+	if reqBody.ExpiresAt != nil && !reqBody.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expiry must be in the future",
+		})
 	}
 
-	for _, path := range filePaths {
+	// Determine when the locks expire, if at all
+	now := time.Now()
+	expiresAt := reqBody.ExpiresAt
+	ttlMinutes := 0
+	if expiresAt != nil {
+		ttlMinutes = int(math.Ceil(expiresAt.Sub(now).Minutes()))
+	} else {
+		ttlMinutes = reqBody.TTLMinutes
+		if ttlMinutes == 0 {
+			ttlMinutes = project.DefaultLockTTLMinutes
+		}
+		if ttlMinutes > 0 {
+			t := now.Add(time.Duration(ttlMinutes) * time.Minute)
+			expiresAt = &t
+		}
+	}
+
+	var locks []models.Lock
+	for _, path := range lo.Uniq(filePaths) {
 		// Check if file is already locked
 		if val, ok := branch.Locks[path]; ok {
-			lockedBy := "(unknown)"
-
-			// Get name of user who locked the file
-			if val != userData.UserID {
-				stytchUser, err := auth.GetStytchUserByID(val)
-				if err != nil {
-					fmt.Printf("Error while getting Stytch user who locked a file: %v\n", err)
-				} else {
-					lockedBy = stytchUser.Name.FirstName + " " + stytchUser.Name.LastName
-				}
-			} else {
-				lockedBy = "you"
-			}
-
-			// Return error
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": fmt.Sprintf("Path \"%s\" is already locked by %s", path, lockedBy),
+				"error": fmt.Sprintf("Path \"%s\" is already locked by %s", path, getLockHolderName(val, userData.UserID)),
 			})
 		}
 
 		// File is available to lock
-		locks[path] = userData.UserID
+		locks = append(locks, models.Lock{
+			ID:         primitive.NewObjectID(),
+			CreatedAt:  now,
+			ProjectID:  branch.ProjectID,
+			BranchID:   branch.ID,
+			Path:       path,
+			UserID:     userData.UserID,
+			Reason:     reqBody.Reason,
+			ExpiresAt:  expiresAt,
+			TTLMinutes: ttlMinutes,
+		})
 	}
 
-	// Add locked paths to branch
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Acquire all locks at once. Another request may have locked some of the paths since the branch was fetched.
+	if err := lock_lib.Acquire(ctx, branch.ID, locks); err != nil {
+		var lockedErr *lock_lib.LockedError
+		if errors.As(err, &lockedErr) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("Path \"%s\" is already locked by %s", lockedErr.Path, getLockHolderName(lockedErr.UserID, userData.UserID)),
+			})
+		}
 
-	if _, err := config.MI.DB.Collection("branches").UpdateByID(ctx, branch.ID, bson.M{"$set": bson.M{"locks": locks}}); err != nil {
-		fmt.Printf("[Lock] Error updating branch: %v\n", err)
+		fmt.Printf("[Lock] Error acquiring locks: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	return nil
+	return c.JSON(locks)
 }
 
 // Remove the lock on one or many files, allowing other users on the project to edit them again.
@@ -177,18 +231,39 @@ func Unlock(c *fiber.Ctx) error {
 		})
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Get committed files of branch head
+	files, err := commit_lib.GetFiles(ctx, &branch.Commit)
+	if err != nil {
+		fmt.Printf("[Unlock] Error getting branch files: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
 	var filePaths []string
 	for _, path := range reqBody.Paths {
 		// Make sure path exists in branch remote
-		if _, ok := branch.Commit.Files[path]; ok {
+		if _, ok := files[path]; ok {
 			// File path exists
 			filePaths = append(filePaths, path)
 		} else {
 			// File path does not exist in branch remote, check if path is a directory
 			found := false
-			for _, key := range lo.Keys(branch.Commit.Files) {
+			dir := strings.TrimSuffix(path, "/") + "/"
+			for _, key := range lo.Keys(files) {
 				// Path is a directory, add all committed files in directory
-				if strings.HasPrefix(key, path) {
+				if key == path || strings.HasPrefix(key, dir) {
+					filePaths = append(filePaths, key)
+					found = true
+				}
+			}
+
+			// Uncommitted files may be locked too (see exclusive checkout)
+			for key := range branch.Locks {
+				if _, committed := files[key]; !committed && (key == path || strings.HasPrefix(key, dir)) {
 					filePaths = append(filePaths, key)
 					found = true
 				}
@@ -205,7 +280,8 @@ func Unlock(c *fiber.Ctx) error {
 	// Get "force" query param
 	force := c.Query("force") == "true"
 
-	// Remove locked paths from branch
+	// Map of path to the user holding its lock, for every lock to release
+	holders := make(map[string]string)
 	for _, path := range filePaths {
 		// Make sure user is the current locker
 		if val, ok := branch.Locks[path]; ok {
@@ -223,19 +299,7 @@ func Unlock(c *fiber.Ctx) error {
 						})
 					}
 				} else {
-					lockedBy := "(unknown)"
-
-					// Get name of user who locked the file
-					if val != userData.UserID {
-						stytchUser, err := auth.GetStytchUserByID(val)
-						if err != nil {
-							fmt.Printf("Error while getting Stytch user who locked a file: %v\n", err)
-						} else {
-							lockedBy = stytchUser.Name.FirstName + " " + stytchUser.Name.LastName
-						}
-					} else {
-						lockedBy = "you"
-					}
+					lockedBy := getLockHolderName(val, userData.UserID)
 
 					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 						"error": "Bad request",
@@ -248,8 +312,7 @@ func Unlock(c *fiber.Ctx) error {
 				}
 			}
 
-			// Delete file lock from branch (a.k.a. unlock the file)
-			delete(branch.Locks, path)
+			holders[path] = val
 		} else {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error": fmt.Sprintf("Path \"%s\" is already unlocked", path),
@@ -257,16 +320,319 @@ func Unlock(c *fiber.Ctx) error {
 		}
 	}
 
-	// Update branch in database
+	// Release the locks (a.k.a. unlock the files). Each lock is only released if it is still held by the user it was
+	// checked against above.
+	released, err := lock_lib.Release(ctx, branch.ID, holders)
+	if err != nil {
+		fmt.Printf("[Unlock] Error releasing locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Let users know that their locks were forcefully released
+	forced := lo.GroupBy(
+		lo.Filter(released, func(lock models.Lock, _ int) bool { return lock.UserID != userData.UserID }),
+		func(lock models.Lock) string { return lock.UserID },
+	)
+	if len(forced) > 0 {
+		adminName := getUserDisplayName(userData.UserID)
+		for holderID, locks := range forced {
+			paths := lo.Map(locks, func(lock models.Lock, _ int) string { return lock.Path })
+			notifyUser(
+				holderID,
+				models.EventTypeLockForceReleased,
+				locks,
+				fmt.Sprintf("Your file locks in %s/%s were released", projectName, branch.Name),
+				fmt.Sprintf(
+					"%s force unlocked the following files you had locked in %s/%s:\n\n  %s\n\n"+
+						"Other users can now change these files. Lock them again before committing your changes to them.\n",
+					adminName,
+					projectName,
+					branch.Name,
+					strings.Join(paths, "\n  "),
+				),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Get the display name of the user holding a lock, or "you" if it's the current user.
+func getLockHolderName(holderID string, currentUserID string) string {
+	if holderID == currentUserID {
+		return "you"
+	}
+
+	return getUserDisplayName(holderID)
+}
+
+// Get the full name of a user, or "(unknown)" if it can't be found.
+func getUserDisplayName(userID string) string {
+	if userID == "" {
+		return "(unknown)"
+	}
+
+	stytchUser, err := auth.GetStytchUserByID(userID)
+	if err != nil {
+		fmt.Printf("Error while getting Stytch user %s: %v\n", userID, err)
+		return "(unknown)"
+	}
+
+	return stytchUser.Name.FirstName + " " + stytchUser.Name.LastName
+}
+
+// Notify a user about an event concerning their locks, both on their event stream and by email. The email is sent in
+// the background, so failing to send it doesn't fail the request.
+func notifyUser(userID string, eventType string, data interface{}, subject string, body string) {
+	if err := events.Publish(userID, eventType, data); err != nil {
+		fmt.Printf("Error while publishing \"%s\" event to user %s: %v\n", eventType, userID, err)
+	}
+
+	go func() {
+		if err := email.SendPlainTextToUser(userID, subject, body); err != nil {
+			fmt.Printf("Error while emailing user %s about \"%s\": %v\n", userID, eventType, err)
+		}
+	}()
+}
+
+// Build a bson filter for active locks from the "user_id" and "prefix" query params of a listing request.
+func lockQueryFilter(c *fiber.Ctx) bson.M {
+	filter := lock_lib.ActiveFilter()
+
+	if userID := c.Query("user_id"); userID != "" {
+		filter["user_id"] = userID
+	}
+
+	if prefix := c.Query("prefix"); prefix != "" {
+		// Anchored regex so the path index can be used for prefix matching
+		filter["path"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	return filter
+}
+
+// Get many locks of a branch.
+//
+// Query params:
+//   - user_id: only return locks held by this user
+//   - prefix: only return locks on paths starting with this prefix
+func GetManyBranchLocks(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if _, err := config.MI.DB.Collection("branches").UpdateByID(ctx, branch.ID, bson.M{"$set": bson.M{"locks": branch.Locks}}); err != nil {
-		fmt.Printf("[Unlock] Error updating branch: %v\n", err)
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetManyBranchLocks] Error getting project: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	return nil
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[GetManyBranchLocks] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	filter := lockQueryFilter(c)
+	filter["branch_id"] = branch.ID
+
+	cur, err := config.MI.DB.Collection("locks").Find(ctx, filter, options.Find().SetSort(bson.M{"path": 1}))
+	if err != nil {
+		fmt.Printf("[GetManyBranchLocks] Error getting locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	result := []models.Lock{}
+	if err := cur.All(ctx, &result); err != nil {
+		fmt.Printf("[GetManyBranchLocks] Error decoding locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// Get many locks across all branches of a project. Locks on branches the user can't access are left out.
+//
+// Query params:
+//   - user_id: only return locks held by this user
+//   - prefix: only return locks on paths starting with this prefix
+//   - branch_name: only return locks on this branch
+func GetManyProjectLocks(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetManyProjectLocks] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get accessible branches
+	branchFilter := bson.M{
+		"project_id": project.ID,
+		"deleted_at": bson.M{"$exists": false},
+		"$and":       []bson.M{branch_lib.AccessFilter(userData, team.ID)},
+	}
+	if branchName := c.Query("branch_name"); branchName != "" {
+		branchFilter["name"] = branchName
+	}
+
+	branchIDs, err := config.MI.DB.Collection("branches").Distinct(ctx, "_id", branchFilter)
+	if err != nil {
+		fmt.Printf("[GetManyProjectLocks] Error getting branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	filter := lockQueryFilter(c)
+	filter["project_id"] = project.ID
+	filter["branch_id"] = bson.M{"$in": branchIDs}
+
+	cur, err := config.MI.DB.Collection("locks").Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "path", Value: 1}, {Key: "branch_id", Value: 1}}),
+	)
+	if err != nil {
+		fmt.Printf("[GetManyProjectLocks] Error getting locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	result := []models.Lock{}
+	if err := cur.All(ctx, &result); err != nil {
+		fmt.Printf("[GetManyProjectLocks] Error decoding locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// Renew the user's expiring locks in a branch, for clients that are still editing the locked files.
+func RenewLocks(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Parse request body
+	var reqBody models.RenewLocksRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&reqBody); err != nil {
+			return err
+		}
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[RenewLocks] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[RenewLocks] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	filter := bson.M{"branch_id": branch.ID, "user_id": userData.UserID}
+	if len(reqBody.Paths) > 0 {
+		// Match paths and everything in directories
+		var pathFilters []bson.M
+		for _, path := range reqBody.Paths {
+			dir := strings.TrimSuffix(path, "/") + "/"
+			pathFilters = append(pathFilters,
+				bson.M{"path": path},
+				bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(dir)}},
+			)
+		}
+		filter["$or"] = pathFilters
+	}
+
+	renewed, err := lock_lib.Renew(ctx, filter, reqBody.TTLMinutes)
+	if err != nil {
+		fmt.Printf("[RenewLocks] Error renewing locks: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"renewed": renewed,
+	})
 }
@@ -3,10 +3,15 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"path"
 	"regexp"
 	"time"
 
 	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/reflog_lib"
 	"github.com/decentvcs/server/lib/team_lib"
 	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
@@ -121,10 +126,23 @@ func CreateProject(c *fiber.Ctx) error {
 	}
 
 	// Create initial commit
+	// Index starts at 1 since in Go, 0 is the default and used to check for empty values
+	index, err := commit_lib.NextIndex(ctx, project.ID)
+	if err != nil {
+		// Delete project
+		config.MI.DB.Collection("projects").DeleteOne(ctx, bson.M{"_id": project.ID})
+
+		// Output error
+		fmt.Printf("[CreateProject] Error allocating initial commit index: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
 	commit := models.Commit{
 		ID:        primitive.NewObjectID(),
 		CreatedAt: time.Now(),
-		Index:     1, // Starts at 1 since in Go, 0 is the default and used to check for empty values
+		Index:     index,
 		ProjectID: project.ID,
 		BranchID:  branchId,
 		Message:   "Initial commit",
@@ -158,6 +176,18 @@ func CreateProject(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := reflog_lib.Record(ctx, &models.ReflogEntry{
+		ProjectID:   project.ID,
+		BranchID:    branch.ID,
+		NewCommitID: commit.ID,
+		Operation:   models.ReflogOperationCreate,
+	}); err != nil {
+		fmt.Printf("[CreateProject] Error recording reflog entry: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"_id":     project.ID.Hex(),
 		"name":    project.Name,
@@ -177,6 +207,7 @@ func CreateProject(c *fiber.Ctx) error {
 
 // Update a project.
 func UpdateProject(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
 
@@ -210,6 +241,34 @@ func UpdateProject(c *fiber.Ctx) error {
 
 		updateData["default_branch_id"] = defBranchID
 	}
+	if body.RequiredApprovals != nil {
+		if !acl.IsRoleAtLeast(acl.GetTeamRole(userData, team.ID), models.RoleAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only admins can change the required number of approvals",
+			})
+		}
+		if *body.RequiredApprovals < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid required approvals; must be a non-negative integer",
+			})
+		}
+
+		updateData["required_approvals"] = *body.RequiredApprovals
+	}
+	if body.DefaultLockTTLMinutes != nil {
+		if !acl.IsRoleAtLeast(acl.GetTeamRole(userData, team.ID), models.RoleAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Only admins can change the default lock TTL",
+			})
+		}
+		if *body.DefaultLockTTLMinutes < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid default lock TTL; must be a non-negative number of minutes",
+			})
+		}
+
+		updateData["default_lock_ttl_minutes"] = *body.DefaultLockTTLMinutes
+	}
 
 	// Update project
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -230,6 +289,114 @@ func UpdateProject(c *fiber.Ctx) error {
 	return c.JSON(updateData)
 }
 
+// Replace the branch protection rules of a project.
+func UpdateBranchProtectionRules(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Parse request body
+	var body models.UpdateBranchProtectionRulesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bad request",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	for _, rule := range body.Rules {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid branch pattern \"%s\"", rule.Pattern),
+			})
+		}
+	}
+	if body.Rules == nil {
+		body.Rules = []models.BranchProtectionRule{}
+	}
+
+	// Update project
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := config.MI.DB.Collection("projects").UpdateOne(
+		ctx,
+		bson.M{"team_id": team.ID, "name": projectName},
+		bson.M{"$set": bson.M{"branch_protection_rules": body.Rules}},
+	)
+	if err != nil {
+		fmt.Printf("[UpdateBranchProtectionRules] Error updating project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	return c.JSON(body.Rules)
+}
+
+// Replace the exclusive checkout patterns of a project.
+func UpdateExclusiveCheckoutPatterns(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Parse request body
+	var body models.UpdateExclusiveCheckoutPatternsRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Bad request",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	for _, pattern := range body.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid file pattern \"%s\"", pattern),
+			})
+		}
+	}
+	if body.Patterns == nil {
+		body.Patterns = []string{}
+	}
+
+	// Update project
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := config.MI.DB.Collection("projects").UpdateOne(
+		ctx,
+		bson.M{"team_id": team.ID, "name": projectName},
+		bson.M{"$set": bson.M{"exclusive_checkout_patterns": body.Patterns}},
+	)
+	if err != nil {
+		fmt.Printf("[UpdateExclusiveCheckoutPatterns] Error updating project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project not found",
+		})
+	}
+
+	return c.JSON(body.Patterns)
+}
+
 // Delete project and all of its subresources.
 func DeleteOneProject(c *fiber.Ctx) error {
 	team := team_lib.GetTeamFromContext(c)
@@ -259,6 +426,69 @@ func DeleteOneProject(c *fiber.Ctx) error {
 		})
 	}
 
+	// Delete all tags for project
+	_, err = config.MI.DB.Collection("tags").DeleteMany(context.Background(), bson.M{"project_id": project.ID})
+	if err != nil {
+		fmt.Printf("[DeleteOneProject] Error deleting all tags for project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Delete reflog for project
+	_, err = config.MI.DB.Collection("reflog").DeleteMany(context.Background(), bson.M{"project_id": project.ID})
+	if err != nil {
+		fmt.Printf("[DeleteOneProject] Error deleting reflog for project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Delete change requests for project, along with their reviews and comments
+	changeRequestIDs, err := config.MI.DB.Collection("change_requests").Distinct(context.Background(), "_id", bson.M{"project_id": project.ID})
+	if err != nil {
+		fmt.Printf("[DeleteOneProject] Error getting change requests for project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	for _, collection := range []string{"change_request_reviews", "change_request_comments"} {
+		_, err = config.MI.DB.Collection(collection).DeleteMany(context.Background(), bson.M{"change_request_id": bson.M{"$in": changeRequestIDs}})
+		if err != nil {
+			fmt.Printf("[DeleteOneProject] Error deleting %s for project: %v\n", collection, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+	_, err = config.MI.DB.Collection("change_requests").DeleteMany(context.Background(), bson.M{"project_id": project.ID})
+	if err != nil {
+		fmt.Printf("[DeleteOneProject] Error deleting change requests for project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Delete locks and unlock requests for project
+	for _, collection := range []string{"locks", "unlock_requests"} {
+		_, err = config.MI.DB.Collection(collection).DeleteMany(context.Background(), bson.M{"project_id": project.ID})
+		if err != nil {
+			fmt.Printf("[DeleteOneProject] Error deleting %s for project: %v\n", collection, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+	}
+
+	// Delete commit index counter for project
+	_, err = config.MI.DB.Collection("counters").DeleteOne(context.Background(), bson.M{"_id": project.ID})
+	if err != nil {
+		fmt.Printf("[DeleteOneProject] Error deleting commit counter for project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
 	// Delete all branches for project
 	_, err = config.MI.DB.Collection("branches").DeleteMany(context.Background(), bson.M{"project_id": project.ID})
 	if err != nil {
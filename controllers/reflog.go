@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/team_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Get the reflog of a branch, newest first.
+//
+// Query params (all optional):
+//   - "limit": Max number of entries to return (default 50, max 200)
+func GetBranchReflog(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	limit, err := strconv.ParseInt(c.Query("limit", "50"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchReflog] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch from database
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[GetBranchReflog] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get reflog entries from database
+	cur, err := config.MI.DB.Collection("reflog").Find(
+		ctx,
+		bson.M{"branch_id": branch.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		fmt.Printf("[GetBranchReflog] Error getting reflog entries: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.ReflogEntry
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.ReflogEntry{}
+	}
+
+	return c.JSON(result)
+}
+
+// Restore a branch to the head it pointed to after the given reflog entry, or before it if the "before" query param is
+// "true".
+//
+// Commits of the branch that are no longer in its history are soft-deleted, and restored commits are undeleted.
+// Only admins can restore protected branches.
+func RestoreBranch(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	entryID, err := primitive.ObjectIDFromHex(c.Params("entry_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid reflog entry ID",
+		})
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[RestoreBranch] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get branch from database
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[RestoreBranch] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Enforce branch protection rules
+	protection := branch_lib.GetProtection(&project, branch.ID, branch.Name)
+	if reason := branch_lib.RewriteDeniedReason(protection, acl.GetTeamRole(userData, team.ID), branch.Name); reason != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": reason,
+		})
+	}
+
+	// Get reflog entry from database
+	var entry models.ReflogEntry
+	if err := config.MI.DB.Collection("reflog").FindOne(ctx, bson.M{"_id": entryID, "branch_id": branch.ID}).Decode(&entry); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Reflog entry not found",
+			})
+		}
+
+		fmt.Printf("[RestoreBranch] Error getting reflog entry: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	targetID := entry.NewCommitID
+	if c.Query("before") == "true" {
+		targetID = entry.OldCommitID
+	}
+	if targetID.IsZero() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Branch did not exist before this reflog entry",
+		})
+	}
+	if targetID == branch.CommitID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Branch already points to this commit",
+		})
+	}
+
+	// Get commit to restore
+	target, err := commit_lib.GetByID(ctx, targetID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Commit has been purged after the retention period and can no longer be restored",
+			})
+		}
+
+		fmt.Printf("[RestoreBranch] Error getting commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Point branch to commit
+	restoreEntry := models.ReflogEntry{
+		ProjectID: project.ID,
+		UserID:    userData.UserID,
+		Operation: models.ReflogOperationRestore,
+	}
+	if err := commit_lib.Reset(ctx, branch.ID, branch.CommitID, target, &restoreEntry); err != nil {
+		if errors.Is(err, commit_lib.ErrBranchMoved) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Branch has moved; please try again",
+			})
+		}
+		if errors.Is(err, commit_lib.ErrNotInHistory) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"error": "Part of the commit's history has been purged and it can no longer be restored",
+			})
+		}
+
+		fmt.Printf("[RestoreBranch] Error resetting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(restoreEntry)
+}
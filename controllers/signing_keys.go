@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/signing"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Get all signing keys of the current user.
+func GetManySigningKeys(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cur, err := config.MI.DB.Collection("signing_keys").Find(ctx, bson.M{"user_id": userData.UserID}, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		fmt.Printf("[GetManySigningKeys] Error getting signing keys: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var result []models.SigningKey
+	cur.All(ctx, &result)
+	if result == nil {
+		result = []models.SigningKey{}
+	}
+
+	return c.JSON(result)
+}
+
+// Register a new ed25519 public key for signing commits.
+func CreateSigningKey(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+
+	// Parse request body
+	var reqBody models.CreateSigningKeyRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if _, err := signing.ParsePublicKey(reqBody.PublicKey); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid public key; must be a base64-encoded ed25519 public key",
+		})
+	}
+
+	key := models.SigningKey{
+		ID:        primitive.NewObjectID(),
+		CreatedAt: time.Now(),
+		UserID:    userData.UserID,
+		Name:      reqBody.Name,
+		PublicKey: reqBody.PublicKey,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := config.MI.DB.Collection("signing_keys").InsertOne(ctx, key); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Signing key is already registered",
+			})
+		}
+
+		fmt.Printf("[CreateSigningKey] Error creating signing key: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(key)
+}
+
+// Delete one of the current user's signing keys.
+// Commits that were already verified with the key stay verified.
+func DeleteSigningKey(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+
+	keyID, err := primitive.ObjectIDFromHex(c.Params("key_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid key ID; must be an ObjectID hexadecimal",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := config.MI.DB.Collection("signing_keys").DeleteOne(ctx, bson.M{"_id": keyID, "user_id": userData.UserID})
+	if err != nil {
+		fmt.Printf("[DeleteSigningKey] Error deleting signing key: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Signing key not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Signing key deleted successfully",
+	})
+}
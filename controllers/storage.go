@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	awstypes "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/manifest_lib"
 	"github.com/decentvcs/server/lib/storage"
 	"github.com/decentvcs/server/lib/team_lib"
 	"github.com/decentvcs/server/models"
@@ -284,7 +285,7 @@ func AbortMultipartUpload(c *fiber.Ctx) error {
 	})
 }
 
-// Delete all unused objects from storage based on commit hash maps.
+// Delete all unused objects from storage based on commit manifests.
 func DeleteUnusedStorageObjects(c *fiber.Ctx) error {
 	team := team_lib.GetTeamFromContext(c)
 	projectName := c.Params("project_name")
@@ -307,31 +308,26 @@ func DeleteUnusedStorageObjects(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get unique file hashes from commit hash maps in database
-	// TODO: Optimize this query
-	var fileHashes []string
-	cur, err := config.MI.DB.Collection("commits").Find(ctx, bson.M{"project_id": project.ID})
+	// Get unique manifest IDs of all commits in the project
+	manifestIDs, err := config.MI.DB.Collection("commits").Distinct(ctx, "manifest_id", bson.M{"project_id": project.ID})
 	if err != nil {
-		fmt.Printf("[DeleteUnusedStorageObjects] Error while finding all commits for project: %v\n", err)
+		fmt.Printf("[DeleteUnusedStorageObjects] Error while getting manifest IDs for project: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	for cur.Next(ctx) {
-		var commit models.Commit
-		err := cur.Decode(&commit)
-		if err != nil {
-			fmt.Printf("Error while decoding commit: %v\n", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Internal server error",
-			})
-		}
-		newFileHashes := lo.Map(lo.Values(commit.Files), func(f models.FileData, _ int) string { return f.Hash })
-		fileHashes = append(fileHashes, newFileHashes...)
-		fileHashes = lo.Uniq(fileHashes)
+	// Get unique file hashes from commit manifests
+	fileHashes, err := manifest_lib.ObjectHashes(ctx, lo.Map(manifestIDs, func(id interface{}, _ int) string {
+		s, _ := id.(string)
+		return s
+	}))
+	if err != nil {
+		fmt.Printf("[DeleteUnusedStorageObjects] Error while getting file hashes from manifests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
 	}
-	cur.Close(ctx)
 
 	// Search for unused objects in storage
 	hasMore := true
@@ -355,7 +351,7 @@ func DeleteUnusedStorageObjects(c *fiber.Ctx) error {
 		startAfter = res.NextContinuationToken
 		for _, metadata := range res.Contents {
 			if !lo.Contains(fileHashes, strings.Replace(*metadata.Key, prefix, "", 1)) {
-				// Object in storage no longer exists in any commit's hash map in the database
+				// Object in storage is no longer referenced by any commit's manifest in the database
 				// Delete it
 				_, err := config.SI.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 					Bucket: &config.SI.ProjectsBucket,
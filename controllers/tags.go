@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/team_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Get many tags for a project, newest first.
+func GetManyTags(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetManyTags] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Hide tags of commits in private branches the user can't access
+	inaccessibleIDs, err := branch_lib.InaccessibleIDs(ctx, project.ID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[GetManyTags] Error getting inaccessible branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get tags from database
+	result, err := getAccessibleTags(ctx, bson.M{"project_id": project.ID}, inaccessibleIDs)
+	if err != nil {
+		fmt.Printf("[GetManyTags] Error getting tags: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// Get one tag by name.
+func GetOneTag(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	tagName := c.Params("tag_name")
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[GetOneTag] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Tags of commits in private branches are only visible to those who can access the branch
+	inaccessibleIDs, err := branch_lib.InaccessibleIDs(ctx, project.ID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[GetOneTag] Error getting inaccessible branches: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get tag from database
+	tags, err := getAccessibleTags(ctx, bson.M{"project_id": project.ID, "name": tagName}, inaccessibleIDs)
+	if err != nil {
+		fmt.Printf("[GetOneTag] Error getting tag: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if len(tags) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+
+	return c.JSON(tags[0])
+}
+
+// Get the tags matching a filter, newest first, leaving out tags of commits in the given branches.
+func getAccessibleTags(ctx context.Context, filter bson.M, hiddenBranchIDs []primitive.ObjectID) ([]models.Tag, error) {
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$sort": bson.D{{Key: "created_at", Value: -1}}},
+	}
+	if len(hiddenBranchIDs) > 0 {
+		pipeline = append(pipeline,
+			bson.M{"$lookup": bson.M{
+				"from": "commits",
+				"let":  bson.M{"commit_id": "$commit_id"},
+				"pipeline": []bson.M{
+					{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$commit_id"}}}},
+					{"$project": bson.M{"branch_id": 1}},
+				},
+				"as": "commit",
+			}},
+			bson.M{"$match": bson.M{"commit.branch_id": bson.M{"$nin": hiddenBranchIDs}}},
+			bson.M{"$unset": "commit"},
+		)
+	}
+
+	cur, err := config.MI.DB.Collection("tags").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []models.Tag{}
+	if err := cur.All(ctx, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Create a new tag.
+//
+// Tags are immutable; an existing tag can only be replaced by an admin with the "force" query param.
+func CreateTag(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	force := c.Query("force") == "true"
+
+	// Parse request body
+	var reqBody models.CreateTagRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Validate tag name.
+	// Purely numeric names are not allowed since they would be ambiguous with commit indexes.
+	regex := regexp.MustCompile(`^[\w\-\.]+$`)
+	if _, err := strconv.Atoi(reqBody.Name); err == nil || !regex.MatchString(reqBody.Name) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid tag name; must be alphanumeric with dashes and dots, and not only digits",
+		})
+	}
+
+	// Only admins can replace existing tags
+	if force {
+		teamAccess, err := acl.HasTeamAccess(userData, team.Name, models.RoleAdmin)
+		if err != nil || !teamAccess.HasAccess {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "You do not have permission to replace tags",
+			})
+		}
+	}
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[CreateTag] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get commit to tag
+	commit, err := commit_lib.ResolveRef(ctx, project.ID, primitive.NilObjectID, reqBody.Commit)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Commit not found",
+			})
+		}
+
+		fmt.Printf("[CreateTag] Error getting commit: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Commits of private branches are only visible to those who can access the branch
+	canAccess, err := branch_lib.CanAccessByID(ctx, commit.BranchID, userData, team.ID)
+	if err != nil {
+		fmt.Printf("[CreateTag] Error checking branch access: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if !canAccess {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Commit not found",
+		})
+	}
+
+	tag := models.Tag{
+		ID:           primitive.NewObjectID(),
+		CreatedAt:    time.Now(),
+		Name:         reqBody.Name,
+		ProjectID:    project.ID,
+		CommitID:     commit.ID,
+		CommitIndex:  commit.Index,
+		AuthorID:     userData.UserID,
+		ReleaseNotes: reqBody.ReleaseNotes,
+	}
+
+	if force {
+		// Replace existing tag in place, keeping its ID, or create it if there is none
+		set := bson.M{
+			"created_at":   tag.CreatedAt,
+			"commit_id":    tag.CommitID,
+			"commit_index": tag.CommitIndex,
+			"author_id":    tag.AuthorID,
+		}
+		update := bson.M{"$set": set, "$setOnInsert": bson.M{"_id": tag.ID}}
+		if tag.ReleaseNotes != "" {
+			set["release_notes"] = tag.ReleaseNotes
+		} else {
+			update["$unset"] = bson.M{"release_notes": ""}
+		}
+
+		if err := config.MI.DB.Collection("tags").FindOneAndUpdate(
+			ctx,
+			bson.M{"project_id": project.ID, "name": tag.Name},
+			update,
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&tag); err != nil {
+			fmt.Printf("[CreateTag] Error replacing tag: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.JSON(tag)
+	}
+
+	// Insert tag into database
+	if _, err := config.MI.DB.Collection("tags").InsertOne(ctx, tag); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "Tag already exists; tags are immutable and can only be replaced by an admin",
+			})
+		}
+
+		fmt.Printf("[CreateTag] Error creating tag: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(tag)
+}
+
+// Delete one tag. Only team admins can delete tags.
+func DeleteOneTag(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	tagName := c.Params("tag_name")
+
+	// Get project from database
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project not found",
+			})
+		}
+
+		fmt.Printf("[DeleteOneTag] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Delete tag
+	res, err := config.MI.DB.Collection("tags").DeleteOne(ctx, bson.M{"project_id": project.ID, "name": tagName})
+	if err != nil {
+		fmt.Printf("[DeleteOneTag] Error deleting tag: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Tag not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Tag deleted successfully",
+	})
+}
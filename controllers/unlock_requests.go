@@ -0,0 +1,457 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/team_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ask the holder of a lock to release it.
+func CreateUnlockRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	// Parse request body
+	var reqBody models.CreateUnlockRequestRequest
+	if err := c.BodyParser(&reqBody); err != nil {
+		return err
+	}
+
+	// Validate request body
+	if err := config.Validator.Struct(reqBody); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, branch, err := branch_lib.GetOne(ctx, team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[CreateUnlockRequest] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Get lock
+	filter := lock_lib.ActiveFilter()
+	filter["branch_id"] = branch.ID
+	filter["path"] = reqBody.Path
+
+	var lock models.Lock
+	if err := config.MI.DB.Collection("locks").FindOne(ctx, filter).Decode(&lock); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Path \"%s\" is not locked", reqBody.Path),
+			})
+		}
+
+		fmt.Printf("[CreateUnlockRequest] Error getting lock: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if lock.UserID == userData.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Path \"%s\" is already locked by you", reqBody.Path),
+		})
+	}
+
+	unlockRequest := models.UnlockRequest{
+		ID:          primitive.NewObjectID(),
+		CreatedAt:   time.Now(),
+		ProjectID:   branch.ProjectID,
+		BranchID:    branch.ID,
+		LockID:      lock.ID,
+		Path:        lock.Path,
+		HolderID:    lock.UserID,
+		RequesterID: userData.UserID,
+		Message:     reqBody.Message,
+		Status:      models.UnlockRequestStatusPending,
+	}
+	if _, err := config.MI.DB.Collection("unlock_requests").InsertOne(ctx, unlockRequest); err != nil {
+		// Users can only have one pending request per lock
+		if mongo.IsDuplicateKeyError(err) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("You already requested path \"%s\" to be unlocked", reqBody.Path),
+			})
+		}
+
+		fmt.Printf("[CreateUnlockRequest] Error inserting unlock request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Notify holder
+	message := ""
+	if unlockRequest.Message != "" {
+		message = fmt.Sprintf("Their message:\n\n  %s\n\n", unlockRequest.Message)
+	}
+	notifyUser(
+		lock.UserID,
+		models.EventTypeUnlockRequested,
+		unlockRequest,
+		fmt.Sprintf("Unlock requested for \"%s\" in %s/%s", lock.Path, projectName, branch.Name),
+		fmt.Sprintf(
+			"%s asked you to unlock \"%s\", which you have locked in %s/%s.\n\n%s"+
+				"You can release the lock, give it to them, or decline the request from your client.\n",
+			getUserDisplayName(userData.UserID),
+			lock.Path,
+			projectName,
+			branch.Name,
+			message,
+		),
+	)
+
+	return c.JSON(unlockRequest)
+}
+
+// Get many unlock requests of a branch, newest first.
+//
+// Query params:
+//   - status: only return requests with this status
+//   - holder_id: only return requests to this user
+//   - requester_id: only return requests by this user
+func GetManyUnlockRequests(c *fiber.Ctx) error {
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, branch, err := branch_lib.GetOne(ctx, team.ID, projectName, branchName)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Branch not found",
+			})
+		}
+
+		fmt.Printf("[GetManyUnlockRequests] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Build bson filter
+	filter := bson.M{"branch_id": branch.ID}
+	for param, field := range map[string]string{"status": "status", "holder_id": "holder_id", "requester_id": "requester_id"} {
+		if val := c.Query(param); val != "" {
+			filter[field] = val
+		}
+	}
+
+	cur, err := config.MI.DB.Collection("unlock_requests").Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}),
+	)
+	if err != nil {
+		fmt.Printf("[GetManyUnlockRequests] Error getting unlock requests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	result := []models.UnlockRequest{}
+	if err := cur.All(ctx, &result); err != nil {
+		fmt.Printf("[GetManyUnlockRequests] Error decoding unlock requests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// Approve an unlock request, either releasing the lock or giving it to the requester. Only the lock's holder can
+// approve requests.
+func ApproveUnlockRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	requestID, err := primitive.ObjectIDFromHex(c.Params("request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid unlock request ID",
+		})
+	}
+
+	// Parse request body
+	var reqBody models.ApproveUnlockRequestRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&reqBody); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	branch, unlockRequest, err := getUnlockRequest(ctx, team.ID, projectName, branchName, requestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Unlock request not found",
+			})
+		}
+
+		fmt.Printf("[ApproveUnlockRequest] Error getting unlock request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if unlockRequest.HolderID != userData.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the holder of the lock can answer this unlock request",
+		})
+	}
+	if unlockRequest.Status != models.UnlockRequestStatusPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Unlock request is no longer pending",
+		})
+	}
+
+	// Mark request as approved first, so that a concurrent decline or cancellation isn't overwritten
+	now := time.Now()
+	res, err := config.MI.DB.Collection("unlock_requests").UpdateOne(
+		ctx,
+		bson.M{"_id": unlockRequest.ID, "status": models.UnlockRequestStatusPending},
+		bson.M{"$set": bson.M{
+			"status":      models.UnlockRequestStatusApproved,
+			"transferred": reqBody.Transfer,
+			"resolved_at": now,
+		}},
+	)
+	if err != nil {
+		fmt.Printf("[ApproveUnlockRequest] Error updating unlock request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Unlock request is no longer pending",
+		})
+	}
+	unlockRequest.Status = models.UnlockRequestStatusApproved
+	unlockRequest.Transferred = reqBody.Transfer
+	unlockRequest.ResolvedAt = &now
+
+	held := true
+	if reqBody.Transfer {
+		// Give the lock to the requester, restarting its expiry
+		update := bson.M{
+			"$set":   bson.M{"user_id": unlockRequest.RequesterID, "created_at": now},
+			"$unset": bson.M{"reason": "", "expiry_warned_at": ""},
+		}
+
+		var lock models.Lock
+		if err := config.MI.DB.Collection("locks").FindOne(ctx, bson.M{"_id": unlockRequest.LockID}).Decode(&lock); err == nil && lock.TTLMinutes > 0 {
+			update["$set"].(bson.M)["expires_at"] = now.Add(time.Duration(lock.TTLMinutes) * time.Minute)
+		}
+
+		// Expired locks can't be handed over
+		filter := lock_lib.ActiveFilter()
+		filter["_id"] = unlockRequest.LockID
+		filter["user_id"] = userData.UserID
+
+		res, err := config.MI.DB.Collection("locks").UpdateOne(ctx, filter, update)
+		if err != nil {
+			fmt.Printf("[ApproveUnlockRequest] Error transferring lock: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		held = res.MatchedCount > 0
+	} else {
+		released, err := lock_lib.Release(ctx, branch.ID, map[string]string{unlockRequest.Path: userData.UserID})
+		if err != nil {
+			fmt.Printf("[ApproveUnlockRequest] Error releasing lock: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+		held = len(released) > 0
+	}
+
+	if !held {
+		// The lock is gone, so there's nothing left to approve
+		if _, err := config.MI.DB.Collection("unlock_requests").UpdateByID(ctx, unlockRequest.ID, bson.M{
+			"$set":   bson.M{"status": models.UnlockRequestStatusCancelled},
+			"$unset": bson.M{"transferred": ""},
+		}); err != nil {
+			fmt.Printf("[ApproveUnlockRequest] Error cancelling unlock request: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Internal server error",
+			})
+		}
+
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("You no longer hold the lock on \"%s\"", unlockRequest.Path),
+		})
+	}
+
+	// Other requests were made to the previous holder
+	if err := lock_lib.CancelUnlockRequests(ctx, []primitive.ObjectID{unlockRequest.LockID}); err != nil {
+		fmt.Printf("[ApproveUnlockRequest] Error cancelling other unlock requests: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	// Notify requester
+	outcome := "released the lock on"
+	if unlockRequest.Transferred {
+		outcome = "gave you the lock on"
+	}
+	notifyUser(
+		unlockRequest.RequesterID,
+		models.EventTypeUnlockRequestApproved,
+		unlockRequest,
+		fmt.Sprintf("Unlock request approved for \"%s\" in %s/%s", unlockRequest.Path, projectName, branch.Name),
+		fmt.Sprintf(
+			"%s approved your request and %s \"%s\" in %s/%s.\n",
+			getUserDisplayName(userData.UserID),
+			outcome,
+			unlockRequest.Path,
+			projectName,
+			branch.Name,
+		),
+	)
+
+	return c.JSON(unlockRequest)
+}
+
+// Decline an unlock request, keeping the lock. Only the lock's holder can decline requests.
+func DeclineUnlockRequest(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	requestID, err := primitive.ObjectIDFromHex(c.Params("request_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid unlock request ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	branch, unlockRequest, err := getUnlockRequest(ctx, team.ID, projectName, branchName, requestID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Unlock request not found",
+			})
+		}
+
+		fmt.Printf("[DeclineUnlockRequest] Error getting unlock request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if unlockRequest.HolderID != userData.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only the holder of the lock can answer this unlock request",
+		})
+	}
+	if unlockRequest.Status != models.UnlockRequestStatusPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Unlock request is no longer pending",
+		})
+	}
+
+	// Mark request as declined
+	now := time.Now()
+	res, err := config.MI.DB.Collection("unlock_requests").UpdateOne(
+		ctx,
+		bson.M{"_id": unlockRequest.ID, "status": models.UnlockRequestStatusPending},
+		bson.M{"$set": bson.M{"status": models.UnlockRequestStatusDeclined, "resolved_at": now}},
+	)
+	if err != nil {
+		fmt.Printf("[DeclineUnlockRequest] Error updating unlock request: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Unlock request is no longer pending",
+		})
+	}
+	unlockRequest.Status = models.UnlockRequestStatusDeclined
+	unlockRequest.ResolvedAt = &now
+
+	// Notify requester
+	notifyUser(
+		unlockRequest.RequesterID,
+		models.EventTypeUnlockRequestDeclined,
+		unlockRequest,
+		fmt.Sprintf("Unlock request declined for \"%s\" in %s/%s", unlockRequest.Path, projectName, branch.Name),
+		fmt.Sprintf(
+			"%s declined your request to unlock \"%s\" in %s/%s, and is keeping the lock for now.\n",
+			getUserDisplayName(userData.UserID),
+			unlockRequest.Path,
+			projectName,
+			branch.Name,
+		),
+	)
+
+	return c.JSON(unlockRequest)
+}
+
+// Get a branch and one of its unlock requests.
+//
+// Returns `mongo.ErrNoDocuments` if either doesn't exist.
+func getUnlockRequest(
+	ctx context.Context,
+	teamID primitive.ObjectID,
+	projectName string,
+	branchName string,
+	requestID primitive.ObjectID,
+) (*models.Branch, *models.UnlockRequest, error) {
+	_, branch, err := branch_lib.GetOne(ctx, teamID, projectName, branchName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unlockRequest models.UnlockRequest
+	if err := config.MI.DB.Collection("unlock_requests").FindOne(ctx, bson.M{"_id": requestID, "branch_id": branch.ID}).Decode(&unlockRequest); err != nil {
+		return nil, nil, err
+	}
+
+	return branch, &unlockRequest, nil
+}
@@ -1,14 +1,19 @@
 package controllers
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/decentvcs/server/config"
 	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/events"
 	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // Get user data for a single user.
@@ -53,3 +58,105 @@ func UpdateUserData(c *fiber.Ctx) error {
 
 	return nil
 }
+
+// Stream the current user's events as server-sent events.
+//
+// Clients resume after the last event they received with the "Last-Event-ID" header, which browsers send when they
+// reconnect, or the "last_event_id" query param. Without either, only new events are streamed.
+func GetMyEvents(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+
+	lastEventIDStr := c.Get("Last-Event-ID", c.Query("last_event_id"))
+	var lastEventID primitive.ObjectID
+	if lastEventIDStr != "" {
+		var err error
+		lastEventID, err = primitive.ObjectIDFromHex(lastEventIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid last event ID"})
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Watch before getting missed events, so nothing is published unseen in between
+	stream, err := events.Watch(ctx, userData.UserID)
+	if err != nil {
+		cancel()
+		fmt.Printf("[GetMyEvents] Error watching events: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+	}
+
+	var missed []models.Event
+	if !lastEventID.IsZero() {
+		missed, err = events.GetMissed(ctx, userData.UserID, lastEventID)
+		if err != nil {
+			stream.Close(context.Background())
+			cancel()
+			fmt.Printf("[GetMyEvents] Error getting missed events: %v\n", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Internal server error"})
+		}
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer stream.Close(context.Background())
+
+		// Missed events may also come through the stream
+		sent := make(map[primitive.ObjectID]bool)
+		writeEvent := func(event models.Event) {
+			if sent[event.ID] {
+				return
+			}
+			sent[event.ID] = true
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Printf("[GetMyEvents] Error encoding event: %v\n", err)
+				return
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID.Hex(), event.Type, data)
+		}
+
+		fmt.Fprint(w, ": connected\n\n")
+		for _, event := range missed {
+			writeEvent(event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		// Comments keep the connection open through proxies, and reveal when the client has disconnected
+		lastHeartbeat := time.Now()
+		for {
+			if stream.TryNext(ctx) {
+				var change struct {
+					FullDocument models.Event `bson:"fullDocument"`
+				}
+				if err := stream.Decode(&change); err != nil {
+					fmt.Printf("[GetMyEvents] Error decoding event: %v\n", err)
+					continue
+				}
+				writeEvent(change.FullDocument)
+			} else if err := stream.Err(); err != nil {
+				fmt.Printf("[GetMyEvents] Error watching events: %v\n", err)
+				return
+			} else if time.Since(lastHeartbeat) < 30*time.Second {
+				continue
+			} else {
+				fmt.Fprint(w, ": heartbeat\n\n")
+				lastHeartbeat = time.Now()
+			}
+
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
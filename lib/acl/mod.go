@@ -64,6 +64,40 @@ func HasTeamAccess(userData *models.UserData, teamName string, minRole models.Ro
 	return models.HasTeamAccessResponse{HasAccess: false}, nil
 }
 
+// Get the user's role in the given team, or `models.RoleNone` if they aren't a member.
+func GetTeamRole(userData *models.UserData, teamID primitive.ObjectID) models.Role {
+	if userData == nil {
+		return models.RoleNone
+	}
+
+	for _, r := range userData.Roles {
+		if r.TeamID == teamID {
+			return r.Role
+		}
+	}
+
+	return models.RoleNone
+}
+
+// Returns true if `role` is `minRole` or higher. Any role satisfies `models.RoleNone`.
+func IsRoleAtLeast(role models.Role, minRole models.Role) bool {
+	if minRole == models.RoleNone {
+		return true
+	}
+
+	roleLvl, err := GetRoleLevel(role)
+	if err != nil {
+		return false
+	}
+
+	minRoleLvl, err := GetRoleLevel(minRole)
+	if err != nil {
+		return false
+	}
+
+	return roleLvl >= minRoleLvl
+}
+
 // Get the numerical level of a role.
 // Useful for comparing roles.
 func GetRoleLevel(role models.Role) (uint, error) {
@@ -2,16 +2,26 @@ package branch_lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
 	"time"
 
 	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/acl"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/manifest_lib"
 	"github.com/decentvcs/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Get branch with its latest commit using a MongoDB aggregation pipeline.
+//
+// Returns `mongo.ErrNoDocuments` if the project or branch doesn't exist.
 func GetOneWithCommit(teamID primitive.ObjectID, projectName string, branchName string) (*models.BranchWithCommit, error) {
 	// Get project from database
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -23,7 +33,7 @@ func GetOneWithCommit(teamID primitive.ObjectID, projectName string, branchName
 	}
 
 	// Get branch from database
-	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, []bson.M{
+	pipeline := []bson.M{
 		{
 			"$match": bson.M{
 				"deleted_at": bson.M{"$exists": false},
@@ -53,19 +63,237 @@ func GetOneWithCommit(teamID primitive.ObjectID, projectName string, branchName
 		{
 			"$limit": 1,
 		},
-	})
+	}
+	pipeline = append(pipeline, lock_lib.LookupStages()...)
+
+	cur, err := config.MI.DB.Collection("branches").Aggregate(ctx, pipeline)
 	if err != nil {
 		return nil, err
 	}
 	defer cur.Close(ctx)
 
 	// Decode first branch
-	cur.Next(ctx)
+	if !cur.Next(ctx) {
+		if err := cur.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, mongo.ErrNoDocuments
+	}
 	var branch models.BranchWithCommit
 	err = cur.Decode(&branch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode branch: %v", err)
+		return nil, fmt.Errorf("failed to decode branch: %w", err)
 	}
 
 	return &branch, nil
 }
+
+// Get a project and one of its live branches by name.
+//
+// Returns `mongo.ErrNoDocuments` if either doesn't exist.
+func GetOne(ctx context.Context, teamID primitive.ObjectID, projectName string, branchName string) (*models.Project, *models.Branch, error) {
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": teamID, "name": projectName}).Decode(&project); err != nil {
+		return nil, nil, err
+	}
+
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		return nil, nil, err
+	}
+
+	return &project, &branch, nil
+}
+
+// Get the effective protection of a branch by combining all of the project's protection rules that match its name.
+// When several rules match, the strictest setting wins. The default branch is always considered protected.
+func GetProtection(project *models.Project, branchID primitive.ObjectID, branchName string) models.BranchProtection {
+	protection := models.BranchProtection{
+		Protected: branchID == project.DefaultBranchID,
+	}
+
+	for _, rule := range project.BranchProtectionRules {
+		if ok, err := path.Match(rule.Pattern, branchName); err != nil || !ok {
+			continue
+		}
+
+		protection.Protected = true
+		if !acl.IsRoleAtLeast(protection.MinCommitRole, rule.MinCommitRole) {
+			protection.MinCommitRole = rule.MinCommitRole
+		}
+		protection.ForbidHistoryRewrite = protection.ForbidHistoryRewrite || rule.ForbidHistoryRewrite
+		protection.ForbidDeletion = protection.ForbidDeletion || rule.ForbidDeletion
+		protection.ForbidRename = protection.ForbidRename || rule.ForbidRename
+		protection.RequireLinearHistory = protection.RequireLinearHistory || rule.RequireLinearHistory
+	}
+
+	return protection
+}
+
+// Returns a message explaining why a user with the given role cannot commit to the branch, or "" if they can.
+func CommitDeniedReason(protection models.BranchProtection, role models.Role, branchName string) string {
+	if !acl.IsRoleAtLeast(role, protection.MinCommitRole) {
+		return fmt.Sprintf("Branch \"%s\" is protected; committing requires the %s role or higher", branchName, protection.MinCommitRole)
+	}
+
+	return ""
+}
+
+// Returns a message explaining why a user with the given role cannot rewrite the history of the branch (squash,
+// delete or restore commits), or "" if they can. Rewriting the history of a protected branch requires admin access.
+func RewriteDeniedReason(protection models.BranchProtection, role models.Role, branchName string) string {
+	if protection.ForbidHistoryRewrite {
+		return fmt.Sprintf("Branch \"%s\" is protected; rewriting its history is not allowed", branchName)
+	}
+
+	if protection.Protected && !acl.IsRoleAtLeast(role, models.RoleAdmin) {
+		return fmt.Sprintf("Branch \"%s\" is protected; only admins can rewrite its history", branchName)
+	}
+
+	return ""
+}
+
+// Compare a branch head with a base branch head, using the cached comparison of the pair if there is one.
+func Compare(ctx context.Context, headID primitive.ObjectID, baseID primitive.ObjectID) (*models.BranchComparison, error) {
+	var comparison models.BranchComparison
+	err := config.MI.DB.Collection("branch_comparisons").FindOne(ctx, bson.M{"head_commit_id": headID, "base_commit_id": baseID}).Decode(&comparison)
+	if err == nil {
+		return &comparison, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	ahead, behind, mergeBaseID, err := commit_lib.AheadBehind(ctx, headID, baseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the paths changed since the merge base, or compared to the base head if the histories don't meet
+	head, err := commit_lib.GetByID(ctx, headID)
+	if err != nil {
+		return nil, err
+	}
+	from := mergeBaseID
+	if from.IsZero() {
+		from = baseID
+	}
+	fromCommit, err := commit_lib.GetByID(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := manifest_lib.Diff(ctx, fromCommit.ManifestID, head.ManifestID)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison = models.BranchComparison{
+		ID:           primitive.NewObjectID(),
+		CreatedAt:    time.Now(),
+		HeadCommitID: headID,
+		BaseCommitID: baseID,
+		MergeBaseID:  mergeBaseID,
+		Ahead:        ahead,
+		Behind:       behind,
+		ChangedPaths: len(diff.Created) + len(diff.Modified) + len(diff.Deleted),
+	}
+
+	// Cache comparison; concurrent requests for the same pair compute the same result, so the first one wins
+	if _, err := config.MI.DB.Collection("branch_comparisons").UpdateOne(
+		ctx,
+		bson.M{"head_commit_id": headID, "base_commit_id": baseID},
+		bson.M{"$setOnInsert": comparison},
+		options.Update().SetUpsert(true),
+	); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	return &comparison, nil
+}
+
+// Returns true if the user can see and use the branch. Private branches are only accessible to their owner and team
+// admins.
+func CanAccess(branchVisibility models.BranchVisibility, ownerID string, userData *models.UserData, teamID primitive.ObjectID) bool {
+	if branchVisibility != models.BranchVisibilityPrivate {
+		return true
+	}
+	if userData == nil {
+		return false
+	}
+
+	return ownerID == userData.UserID || acl.IsRoleAtLeast(acl.GetTeamRole(userData, teamID), models.RoleAdmin)
+}
+
+// Returns true if the user can access the branch with the given ID, including soft-deleted branches. Branches that no
+// longer exist are considered accessible, so that commits outliving their branch stay visible.
+func CanAccessByID(ctx context.Context, branchID primitive.ObjectID, userData *models.UserData, teamID primitive.ObjectID) (bool, error) {
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(
+		ctx,
+		bson.M{"_id": branchID},
+		options.FindOne().SetProjection(bson.M{"visibility": 1, "owner_id": 1}),
+	).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return true, nil
+		}
+
+		return false, err
+	}
+
+	return CanAccess(branch.Visibility, branch.OwnerID, userData, teamID), nil
+}
+
+// Get the IDs of a project's branches that the user can't access, including soft-deleted branches, so that their
+// commits can be excluded from queries using "$nin".
+func InaccessibleIDs(ctx context.Context, projectID primitive.ObjectID, userData *models.UserData, teamID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	ids := []primitive.ObjectID{}
+	if userData != nil && acl.IsRoleAtLeast(acl.GetTeamRole(userData, teamID), models.RoleAdmin) {
+		return ids, nil
+	}
+
+	userID := ""
+	if userData != nil {
+		userID = userData.UserID
+	}
+
+	values, err := config.MI.DB.Collection("branches").Distinct(ctx, "_id", bson.M{
+		"project_id": projectID,
+		"visibility": models.BranchVisibilityPrivate,
+		"owner_id":   bson.M{"$ne": userID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Get a filter for branches that the user can access, to be combined with other filters using "$and".
+func AccessFilter(userData *models.UserData, teamID primitive.ObjectID) bson.M {
+	if userData != nil && acl.IsRoleAtLeast(acl.GetTeamRole(userData, teamID), models.RoleAdmin) {
+		return bson.M{}
+	}
+
+	userID := ""
+	if userData != nil {
+		userID = userData.UserID
+	}
+
+	return bson.M{
+		"$or": []bson.M{
+			{"visibility": bson.M{"$ne": models.BranchVisibilityPrivate}},
+			{"owner_id": userID},
+		},
+	}
+}
@@ -0,0 +1,182 @@
+package change_request_lib
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/lib/manifest_lib"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Returned when a change request is no longer open, e.g. because it was merged concurrently.
+var ErrNotOpen = errors.New("change request is not open")
+
+// Get a project and one of its change requests.
+//
+// Returns `mongo.ErrNoDocuments` if either doesn't exist.
+func GetOne(ctx context.Context, teamID primitive.ObjectID, projectName string, changeRequestID primitive.ObjectID) (*models.Project, *models.ChangeRequest, error) {
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": teamID, "name": projectName}).Decode(&project); err != nil {
+		return nil, nil, err
+	}
+
+	var changeRequest models.ChangeRequest
+	if err := config.MI.DB.Collection("change_requests").FindOne(ctx, bson.M{"_id": changeRequestID, "project_id": project.ID}).Decode(&changeRequest); err != nil {
+		return nil, nil, err
+	}
+
+	return &project, &changeRequest, nil
+}
+
+// Get the source and target branches of a change request with their head commits.
+//
+// Returns `mongo.ErrNoDocuments` if either branch was deleted.
+func GetBranches(ctx context.Context, changeRequest *models.ChangeRequest) (source *models.BranchWithCommit, target *models.BranchWithCommit, err error) {
+	source, err = getBranchWithCommit(ctx, changeRequest.SourceBranchID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target, err = getBranchWithCommit(ctx, changeRequest.TargetBranchID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return source, target, nil
+}
+
+func getBranchWithCommit(ctx context.Context, branchID primitive.ObjectID) (*models.BranchWithCommit, error) {
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"_id":        branchID,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		return nil, err
+	}
+
+	commit, err := commit_lib.GetByID(ctx, branch.CommitID)
+	if err != nil {
+		return nil, err
+	}
+
+	locks, err := lock_lib.GetMap(ctx, branch.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BranchWithCommit{
+		ID:        branch.ID,
+		CreatedAt: branch.CreatedAt,
+		Name:      branch.Name,
+		ProjectID: branch.ProjectID,
+		Commit:    *commit,
+		Locks:     locks,
+	}, nil
+}
+
+// Compute the changes of the source commit since its nearest common ancestor with the target commit.
+//
+// Paths that were also changed in the target since the common ancestor, to a different state than in the source, are
+// reported as conflicts.
+func Diff(ctx context.Context, source *models.Commit, target *models.Commit) (*models.ChangeRequestDiff, error) {
+	base, err := commit_lib.CommonAncestor(ctx, source.ID, target.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceDiff, err := manifest_lib.Diff(ctx, base.ManifestID, source.ManifestID)
+	if err != nil {
+		return nil, err
+	}
+	targetDiff, err := manifest_lib.Diff(ctx, base.ManifestID, target.ManifestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Final state of every path changed in the target; `nil` if it was deleted
+	targetChanges := make(map[string]*models.FileData)
+	for p, data := range targetDiff.Created {
+		data := data
+		targetChanges[p] = &data
+	}
+	for p, data := range targetDiff.Modified {
+		data := data
+		targetChanges[p] = &data
+	}
+	for _, p := range targetDiff.Deleted {
+		targetChanges[p] = nil
+	}
+
+	conflicts := []string{}
+	for p, data := range sourceDiff.Created {
+		if targetData, ok := targetChanges[p]; ok && (targetData == nil || !manifest_lib.FileDataEqual(*targetData, data)) {
+			conflicts = append(conflicts, p)
+		}
+	}
+	for p, data := range sourceDiff.Modified {
+		if targetData, ok := targetChanges[p]; ok && (targetData == nil || !manifest_lib.FileDataEqual(*targetData, data)) {
+			conflicts = append(conflicts, p)
+		}
+	}
+	for _, p := range sourceDiff.Deleted {
+		if targetData, ok := targetChanges[p]; ok && targetData != nil {
+			conflicts = append(conflicts, p)
+		}
+	}
+	sort.Strings(conflicts)
+
+	return &models.ChangeRequestDiff{
+		MergeBase: base,
+		Source:    source,
+		Target:    target,
+		Created:   sourceDiff.Created,
+		Modified:  sourceDiff.Modified,
+		Deleted:   sourceDiff.Deleted,
+		Conflicts: conflicts,
+	}, nil
+}
+
+// Count the approvals of a change request that apply to the given source head commit, and check whether any reviewer
+// requested changes to it. Only the latest review of each reviewer counts.
+func GetReviewSummary(ctx context.Context, changeRequestID primitive.ObjectID, headID primitive.ObjectID) (approvals int, changesRequested bool, err error) {
+	cur, err := config.MI.DB.Collection("change_request_reviews").Find(
+		ctx,
+		bson.M{"change_request_id": changeRequestID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var reviews []models.ChangeRequestReview
+	if err := cur.All(ctx, &reviews); err != nil {
+		return 0, false, err
+	}
+
+	latest := make(map[string]models.ChangeRequestReview)
+	for _, review := range reviews {
+		latest[review.ReviewerID] = review
+	}
+
+	for _, review := range latest {
+		if review.CommitID != headID {
+			continue
+		}
+
+		switch review.State {
+		case models.ReviewStateApproved:
+			approvals++
+		case models.ReviewStateChangesRequested:
+			changesRequested = true
+		}
+	}
+
+	return approvals, changesRequested, nil
+}
@@ -0,0 +1,823 @@
+package commit_lib
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/manifest_lib"
+	"github.com/decentvcs/server/lib/reflog_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Returned by `Create` when the branch no longer points to the expected head commit.
+var ErrBranchMoved = errors.New("branch head has moved")
+
+// Atomically allocate the next commit index for a project.
+func NextIndex(ctx context.Context, projectID primitive.ObjectID) (int, error) {
+	var counter models.Counter
+	if err := config.MI.DB.Collection("counters").FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": projectID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter); err != nil {
+		return 0, err
+	}
+
+	return counter.Seq, nil
+}
+
+// Insert a new commit and point the branch to it in a single transaction.
+// The commit's index is allocated as part of the transaction.
+//
+// Unless `commit.ManifestID` is already set, the commit's manifest is built by applying `ChangedFiles` and
+// `DeletedFiles` to the manifest of its first parent.
+//
+// The branch is only updated if it still points to `expectedHeadID`. Otherwise, nothing is written and
+// `ErrBranchMoved` is returned so the caller can report the new head to the client.
+//
+// The head movement is recorded in the reflog with the given operation, attributed to the commit's author.
+func Create(ctx context.Context, commit *models.Commit, expectedHeadID primitive.ObjectID, operation string) error {
+	return CreateWith(ctx, commit, expectedHeadID, operation, nil)
+}
+
+// Like `Create`, but also runs `also` (if set) in the same transaction after the branch was moved, so that related
+// writes are applied together with the commit. If `also` returns an error, nothing is written and the error is
+// returned.
+func CreateWith(
+	ctx context.Context,
+	commit *models.Commit,
+	expectedHeadID primitive.ObjectID,
+	operation string,
+	also func(ctx context.Context) error,
+) error {
+	if commit.ManifestID == "" {
+		var baseManifestID string
+		if len(commit.ParentIDs) > 0 {
+			parent, err := GetByID(ctx, commit.ParentIDs[0])
+			if err != nil {
+				return err
+			}
+
+			baseManifestID = parent.ManifestID
+		}
+
+		manifestID, err := manifest_lib.Apply(ctx, baseManifestID, commit.ChangedFiles, commit.DeletedFiles)
+		if err != nil {
+			return err
+		}
+		commit.ManifestID = manifestID
+	}
+
+	// Full file maps are never stored with the commit
+	commit.Files = nil
+
+	session, err := config.MI.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := insert(sc, commit); err != nil {
+			return nil, err
+		}
+
+		if err := moveHead(sc, &models.ReflogEntry{
+			ProjectID:   commit.ProjectID,
+			BranchID:    commit.BranchID,
+			OldCommitID: expectedHeadID,
+			NewCommitID: commit.ID,
+			UserID:      commit.AuthorID,
+			Operation:   operation,
+		}); err != nil {
+			return nil, err
+		}
+
+		if also != nil {
+			return nil, also(sc)
+		}
+		return nil, nil
+	})
+
+	return err
+}
+
+// Replace part of a branch's history in a single transaction.
+//
+// `commits` are inserted in order and the branch is pointed to the last one. Unlike `Create`, each commit must
+// already have `ManifestID` set. The commits in `replacedIDs` are soft-deleted, and the movement is recorded in the
+// reflog using `entry`. If `replacedIDs` is empty, the commits are simply added on top of the branch.
+//
+// The branch is only updated if it still points to `expectedHeadID`. Otherwise, nothing is written and
+// `ErrBranchMoved` is returned.
+func Rewrite(
+	ctx context.Context,
+	branchID primitive.ObjectID,
+	expectedHeadID primitive.ObjectID,
+	commits []*models.Commit,
+	replacedIDs []primitive.ObjectID,
+	entry *models.ReflogEntry,
+) error {
+	if len(commits) == 0 {
+		return errors.New("no commits to write")
+	}
+
+	for _, commit := range commits {
+		if commit.ManifestID == "" {
+			return errors.New("commit has no manifest")
+		}
+
+		commit.Files = nil
+	}
+
+	session, err := config.MI.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		for _, commit := range commits {
+			if err := insert(sc, commit); err != nil {
+				return nil, err
+			}
+		}
+
+		// Keep replaced commits around for recovery, but hide them from history
+		if err := softDelete(sc, branchID, replacedIDs); err != nil {
+			return nil, err
+		}
+
+		entry.BranchID = branchID
+		entry.OldCommitID = expectedHeadID
+		entry.NewCommitID = commits[len(commits)-1].ID
+		entry.RemovedCommitIDs = replacedIDs
+		return nil, moveHead(sc, entry)
+	})
+
+	return err
+}
+
+// Allocate the commit's index and insert it.
+func insert(ctx context.Context, commit *models.Commit) error {
+	index, err := NextIndex(ctx, commit.ProjectID)
+	if err != nil {
+		return err
+	}
+	commit.Index = index
+
+	_, err = config.MI.DB.Collection("commits").InsertOne(ctx, commit)
+	return err
+}
+
+// Point a branch from `entry.OldCommitID` to `entry.NewCommitID` and record the movement in the reflog.
+//
+// Returns `ErrBranchMoved` if the branch no longer points to `entry.OldCommitID`.
+func moveHead(ctx context.Context, entry *models.ReflogEntry) error {
+	res, err := config.MI.DB.Collection("branches").UpdateOne(
+		ctx,
+		bson.M{"_id": entry.BranchID, "commit_id": entry.OldCommitID},
+		bson.M{"$set": bson.M{"commit_id": entry.NewCommitID}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrBranchMoved
+	}
+
+	return reflog_lib.Record(ctx, entry)
+}
+
+// Soft-delete commits of a branch, so that they're hidden from history until they're purged after the retention
+// period.
+func softDelete(ctx context.Context, branchID primitive.ObjectID, commitIDs []primitive.ObjectID) error {
+	if len(commitIDs) == 0 {
+		return nil
+	}
+
+	_, err := config.MI.DB.Collection("commits").UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": commitIDs}, "branch_id": branchID, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+	)
+	return err
+}
+
+// Point a branch to an existing commit in a single transaction.
+//
+// Commits of the branch that are no longer in its history are soft-deleted, and soft-deleted commits that are back in
+// its history are restored. The movement is recorded in the reflog using `entry`.
+//
+// The branch is only updated if it still points to `expectedHeadID`. Otherwise, nothing is written and
+// `ErrBranchMoved` is returned.
+func Reset(
+	ctx context.Context,
+	branchID primitive.ObjectID,
+	expectedHeadID primitive.ObjectID,
+	target *models.Commit,
+	entry *models.ReflogEntry,
+) error {
+	base, err := MergeBase(ctx, expectedHeadID, target.ID)
+	if err != nil {
+		return err
+	}
+
+	removed, err := GetHistoryUntil(ctx, expectedHeadID, base.ID)
+	if err != nil {
+		return err
+	}
+	removedIDs := lo.Map(removed[:len(removed)-1], func(commit models.Commit, _ int) primitive.ObjectID { return commit.ID })
+
+	restored, err := GetHistoryUntil(ctx, target.ID, base.ID)
+	if err != nil {
+		return err
+	}
+	restoredIDs := lo.Map(restored[:len(restored)-1], func(commit models.Commit, _ int) primitive.ObjectID { return commit.ID })
+
+	session, err := config.MI.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := softDelete(sc, branchID, removedIDs); err != nil {
+			return nil, err
+		}
+
+		if len(restoredIDs) > 0 {
+			if _, err := config.MI.DB.Collection("commits").UpdateMany(
+				sc,
+				bson.M{"_id": bson.M{"$in": restoredIDs}},
+				bson.M{"$unset": bson.M{"deleted_at": ""}},
+			); err != nil {
+				return nil, err
+			}
+		}
+
+		entry.BranchID = branchID
+		entry.OldCommitID = expectedHeadID
+		entry.NewCommitID = target.ID
+		entry.RemovedCommitIDs = removedIDs
+		return nil, moveHead(sc, entry)
+	})
+
+	return err
+}
+
+// Returned by `GetHistoryUntil` when the requested commit is not in the history of the head commit.
+var ErrNotInHistory = errors.New("commit is not in the history of the branch")
+
+// Get a commit by its project-wide index.
+func GetByIndex(ctx context.Context, projectID primitive.ObjectID, index int) (*models.Commit, error) {
+	var commit models.Commit
+	if err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"project_id": projectID, "index": index}).Decode(&commit); err != nil {
+		return nil, err
+	}
+
+	return &commit, nil
+}
+
+// Get a commit by index as referenced from a branch.
+//
+// Commit indexes used to be numbered per branch, so commits of different branches could share an index until
+// duplicates were renumbered (keeping their old number in `legacy_index`). To keep references made before then
+// working, a commit of the branch with a matching legacy index takes precedence over the commit with that index.
+func GetByIndexInBranch(ctx context.Context, projectID primitive.ObjectID, branchID primitive.ObjectID, index int) (*models.Commit, error) {
+	var commit models.Commit
+	err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{
+		"project_id":   projectID,
+		"branch_id":    branchID,
+		"legacy_index": index,
+	}).Decode(&commit)
+	if err == nil {
+		return &commit, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	return GetByIndex(ctx, projectID, index)
+}
+
+// Get a commit by ID.
+func GetByID(ctx context.Context, commitID primitive.ObjectID) (*models.Commit, error) {
+	var commit models.Commit
+	if err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"_id": commitID}).Decode(&commit); err != nil {
+		return nil, err
+	}
+
+	return &commit, nil
+}
+
+// Get the IDs of the commits in the first-parent history of `headID` (inclusive), ordered newest first.
+// The history ends at a root commit, or at a purged commit.
+func GetFirstParentHistory(ctx context.Context, headID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var history []primitive.ObjectID
+	for currentID := headID; !currentID.IsZero(); {
+		parentID, err := firstParentID(ctx, currentID)
+		if err != nil {
+			if errors.Is(err, ErrNotInHistory) {
+				break
+			}
+
+			return nil, err
+		}
+
+		history = append(history, currentID)
+		currentID = parentID
+	}
+
+	return history, nil
+}
+
+// Walk the first-parent history from `headID` back to `stopID` (both inclusive).
+// Returned commits are ordered newest first and do not include their changed file data.
+//
+// Returns `ErrNotInHistory` if `stopID` is not reached.
+func GetHistoryUntil(ctx context.Context, headID primitive.ObjectID, stopID primitive.ObjectID) ([]models.Commit, error) {
+	var history []models.Commit
+	opts := options.FindOne().SetProjection(bson.M{"changed_files": 0})
+
+	currentID := headID
+	for {
+		var commit models.Commit
+		if err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"_id": currentID}, opts).Decode(&commit); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, ErrNotInHistory
+			}
+
+			return nil, err
+		}
+
+		history = append(history, commit)
+		if commit.ID == stopID {
+			return history, nil
+		}
+
+		if len(commit.ParentIDs) == 0 {
+			return nil, ErrNotInHistory
+		}
+		currentID = commit.ParentIDs[0]
+	}
+}
+
+// Find the nearest commit that is in the first-parent histories of both commits.
+//
+// Returns `ErrNotInHistory` if the histories don't meet.
+func MergeBase(ctx context.Context, aID primitive.ObjectID, bID primitive.ObjectID) (*models.Commit, error) {
+	seenA := make(map[primitive.ObjectID]bool)
+	seenB := make(map[primitive.ObjectID]bool)
+
+	// Walk both histories one commit at a time, so that the walk stops shortly after the base when the histories
+	// have very different lengths
+	currentA, currentB := aID, bID
+	for !currentA.IsZero() || !currentB.IsZero() {
+		if !currentA.IsZero() {
+			if seenB[currentA] {
+				return GetByID(ctx, currentA)
+			}
+			seenA[currentA] = true
+
+			parentID, err := firstParentID(ctx, currentA)
+			if err != nil {
+				return nil, err
+			}
+			currentA = parentID
+		}
+
+		if !currentB.IsZero() {
+			if seenA[currentB] {
+				return GetByID(ctx, currentB)
+			}
+			seenB[currentB] = true
+
+			parentID, err := firstParentID(ctx, currentB)
+			if err != nil {
+				return nil, err
+			}
+			currentB = parentID
+		}
+	}
+
+	return nil, ErrNotInHistory
+}
+
+// Find the nearest commit that is in the full histories of both commits, following all parents of merge commits.
+// Unlike `MergeBase`, this takes commits into account that were merged from one history into the other.
+//
+// Returns `ErrNotInHistory` if the histories don't meet.
+func CommonAncestor(ctx context.Context, aID primitive.ObjectID, bID primitive.ObjectID) (*models.Commit, error) {
+	seen := [2]map[primitive.ObjectID]bool{{}, {}}
+	queues := [2][]primitive.ObjectID{{aID}, {bID}}
+
+	// Walk both histories breadth-first, one commit at a time on each side
+	for len(queues[0]) > 0 || len(queues[1]) > 0 {
+		for side := 0; side < 2; side++ {
+			if len(queues[side]) == 0 {
+				continue
+			}
+
+			current := queues[side][0]
+			queues[side] = queues[side][1:]
+			if seen[side][current] {
+				continue
+			}
+			if seen[1-side][current] {
+				return GetByID(ctx, current)
+			}
+			seen[side][current] = true
+
+			parentIDs, err := getParentIDs(ctx, current)
+			if err != nil {
+				return nil, err
+			}
+			queues[side] = append(queues[side], parentIDs...)
+		}
+	}
+
+	return nil, ErrNotInHistory
+}
+
+// Count the commits that are only in the history of `aID` (ahead) and only in the history of `bID` (behind),
+// following all parents of merge commits. Also returns the ID of the newest common ancestor, or
+// `primitive.NilObjectID` if the histories don't meet.
+//
+// Parents always have lower indexes than their children, so both histories are walked together from the highest
+// index down, and the walk stops as soon as only commits in both histories are left.
+func AheadBehind(ctx context.Context, aID primitive.ObjectID, bID primitive.ObjectID) (ahead int, behind int, baseID primitive.ObjectID, err error) {
+	return aheadBehind(ctx, aID, bID, getGraphNodes)
+}
+
+// Index and parents of a commit, which is all that history walks need.
+type graphNode struct {
+	Index     int
+	ParentIDs []primitive.ObjectID
+}
+
+// Gets the graph nodes of the given commits. Commits that don't exist (e.g. because they were purged) are omitted.
+type graphNodeFetcher func(ctx context.Context, commitIDs []primitive.ObjectID) (map[primitive.ObjectID]graphNode, error)
+
+// Get the graph nodes of many commits in a single query.
+func getGraphNodes(ctx context.Context, commitIDs []primitive.ObjectID) (map[primitive.ObjectID]graphNode, error) {
+	cur, err := config.MI.DB.Collection("commits").Find(
+		ctx,
+		bson.M{"_id": bson.M{"$in": commitIDs}},
+		options.Find().SetProjection(bson.M{"index": 1, "parent_ids": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []models.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[primitive.ObjectID]graphNode, len(commits))
+	for _, commit := range commits {
+		nodes[commit.ID] = graphNode{Index: commit.Index, ParentIDs: commit.ParentIDs}
+	}
+
+	return nodes, nil
+}
+
+// Max-heap of commit IDs by index.
+type indexHeap struct {
+	ids   []primitive.ObjectID
+	nodes map[primitive.ObjectID]graphNode
+}
+
+func (h indexHeap) Len() int            { return len(h.ids) }
+func (h indexHeap) Less(i, j int) bool  { return h.nodes[h.ids[i]].Index > h.nodes[h.ids[j]].Index }
+func (h indexHeap) Swap(i, j int)       { h.ids[i], h.ids[j] = h.ids[j], h.ids[i] }
+func (h *indexHeap) Push(x interface{}) { h.ids = append(h.ids, x.(primitive.ObjectID)) }
+func (h *indexHeap) Pop() interface{} {
+	last := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return last
+}
+
+// Implementation of `AheadBehind` with a custom source of commits.
+//
+// Newly discovered commits are fetched together, in one batch per step of the walk. A batch is only fetched when the
+// next commit to visit could be one of them, i.e. when no queued commit has a higher index than the child they were
+// discovered from.
+func aheadBehind(ctx context.Context, aID primitive.ObjectID, bID primitive.ObjectID, fetch graphNodeFetcher) (ahead int, behind int, baseID primitive.ObjectID, err error) {
+	const inA, inB, inBoth = 1, 2, 3
+
+	nodes := make(map[primitive.ObjectID]graphNode)
+	flags := make(map[primitive.ObjectID]int)
+	// Commits waiting to be visited, either fetched and in `queue`, or in `pending` until they're fetched
+	queued := make(map[primitive.ObjectID]bool)
+	queue := &indexHeap{nodes: nodes}
+	var pending []primitive.ObjectID
+	// Upper bound (exclusive) of the indexes of pending commits
+	pendingBound := 0
+	// Number of queued commits that aren't in both histories yet
+	active := 0
+
+	enqueue := func(commitID primitive.ObjectID, flag int, bound int) {
+		old, seen := flags[commitID]
+		if old|flag == old {
+			return
+		}
+		flags[commitID] = old | flag
+
+		if !seen {
+			queued[commitID] = true
+			pending = append(pending, commitID)
+			if bound > pendingBound {
+				pendingBound = bound
+			}
+			if old|flag != inBoth {
+				active++
+			}
+		} else if old|flag == inBoth && queued[commitID] {
+			active--
+		}
+	}
+
+	fetchPending := func() error {
+		fetched, err := fetch(ctx, pending)
+		if err != nil {
+			return err
+		}
+
+		for _, commitID := range pending {
+			node, ok := fetched[commitID]
+			if !ok {
+				// Purged commits end the history
+				if flags[commitID] != inBoth {
+					active--
+				}
+				delete(queued, commitID)
+				continue
+			}
+
+			nodes[commitID] = node
+			heap.Push(queue, commitID)
+		}
+
+		pending = nil
+		pendingBound = 0
+		return nil
+	}
+
+	// Heads have no known bound
+	enqueue(aID, inA, math.MaxInt)
+	enqueue(bID, inB, math.MaxInt)
+
+	for {
+		if len(pending) > 0 && (queue.Len() == 0 || nodes[queue.ids[0]].Index < pendingBound) {
+			if err := fetchPending(); err != nil {
+				return 0, 0, primitive.NilObjectID, err
+			}
+		}
+		if active == 0 || queue.Len() == 0 {
+			break
+		}
+
+		// Visit the queued commit with the highest index.
+		// All of its children were already visited, so its flags are final.
+		current := heap.Pop(queue).(primitive.ObjectID)
+		delete(queued, current)
+
+		flag := flags[current]
+		switch flag {
+		case inA:
+			ahead++
+			active--
+		case inB:
+			behind++
+			active--
+		case inBoth:
+			if baseID.IsZero() {
+				baseID = current
+			}
+		}
+
+		for _, parentID := range nodes[current].ParentIDs {
+			enqueue(parentID, flag, nodes[current].Index)
+		}
+	}
+
+	// The newest common ancestor may not have been visited yet
+	if baseID.IsZero() {
+		if len(pending) > 0 {
+			if err := fetchPending(); err != nil {
+				return 0, 0, primitive.NilObjectID, err
+			}
+		}
+		if queue.Len() > 0 {
+			baseID = queue.ids[0]
+		}
+	}
+
+	return ahead, behind, baseID, nil
+}
+
+// Get the ID of a commit's first parent, or `primitive.NilObjectID` if it has none.
+func firstParentID(ctx context.Context, commitID primitive.ObjectID) (primitive.ObjectID, error) {
+	parentIDs, err := getParentIDs(ctx, commitID)
+	if err != nil || len(parentIDs) == 0 {
+		return primitive.NilObjectID, err
+	}
+
+	return parentIDs[0], nil
+}
+
+// Get the IDs of a commit's parents.
+//
+// Returns `ErrNotInHistory` if the commit doesn't exist (e.g. it was purged).
+func getParentIDs(ctx context.Context, commitID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var commit models.Commit
+	if err := config.MI.DB.Collection("commits").FindOne(
+		ctx,
+		bson.M{"_id": commitID},
+		options.FindOne().SetProjection(bson.M{"parent_ids": 1}),
+	).Decode(&commit); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotInHistory
+		}
+
+		return nil, err
+	}
+
+	return commit.ParentIDs, nil
+}
+
+// Get the commit that a branch pointed to at the given time.
+//
+// Recorded head movements are used where the reflog covers the time, so that resets and restores are honored. For
+// earlier times, falls back to the newest commit created at or before the time in the first-parent history of the
+// earliest recorded head (or `currentHeadID` if nothing was recorded).
+//
+// Returns `mongo.ErrNoDocuments` if the branch had no commit at the time.
+func HeadAt(ctx context.Context, branchID primitive.ObjectID, currentHeadID primitive.ObjectID, asOf time.Time) (*models.Commit, error) {
+	entry, err := reflog_lib.GetLatestAt(ctx, branchID, asOf)
+	if err == nil {
+		return GetByID(ctx, entry.NewCommitID)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// No movement recorded at or before the time
+	startID := currentHeadID
+	oldest, err := reflog_lib.GetOldest(ctx, branchID)
+	if err == nil {
+		if oldest.OldCommitID.IsZero() {
+			// Branch was created after the time
+			return nil, mongo.ErrNoDocuments
+		}
+		startID = oldest.OldCommitID
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"changed_files": 0})
+	currentID := startID
+	for {
+		var commit models.Commit
+		if err := config.MI.DB.Collection("commits").FindOne(ctx, bson.M{"_id": currentID}, opts).Decode(&commit); err != nil {
+			return nil, err
+		}
+
+		if !commit.CreatedAt.After(asOf) {
+			return GetByID(ctx, commit.ID)
+		}
+
+		if len(commit.ParentIDs) == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		currentID = commit.ParentIDs[0]
+	}
+}
+
+// Returns all paths created, modified, or deleted by a commit.
+func ChangedPaths(commit models.Commit) []string {
+	var paths []string
+	paths = append(paths, commit.CreatedFiles...)
+	paths = append(paths, commit.ModifiedFiles...)
+	paths = append(paths, commit.DeletedFiles...)
+	return paths
+}
+
+// Get a commit by reference, which is either a commit index or a tag name.
+//
+// If `branchID` is set, indexes are resolved as referenced from that branch (see `GetByIndexInBranch`).
+//
+// Returns `mongo.ErrNoDocuments` if no commit or tag matches the reference.
+func ResolveRef(ctx context.Context, projectID primitive.ObjectID, branchID primitive.ObjectID, ref string) (*models.Commit, error) {
+	if index, err := strconv.Atoi(ref); err == nil {
+		if index <= 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+
+		if !branchID.IsZero() {
+			return GetByIndexInBranch(ctx, projectID, branchID, index)
+		}
+		return GetByIndex(ctx, projectID, index)
+	}
+
+	var tag models.Tag
+	if err := config.MI.DB.Collection("tags").FindOne(ctx, bson.M{"project_id": projectID, "name": ref}).Decode(&tag); err != nil {
+		return nil, err
+	}
+
+	return GetByID(ctx, tag.CommitID)
+}
+
+// Get the full file map of a commit, materialized from its manifest.
+func GetFiles(ctx context.Context, commit *models.Commit) (map[string]models.FileData, error) {
+	return manifest_lib.Load(ctx, commit.ManifestID)
+}
+
+// Get the file map of a commit, limited to the given paths.
+// Paths that don't exist in the commit are omitted.
+func GetFilesAt(ctx context.Context, commit *models.Commit, paths []string) (map[string]models.FileData, error) {
+	return manifest_lib.LoadPaths(ctx, commit.ManifestID, paths)
+}
+
+// Position in a list of commits ordered by creation date and ID.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+	// If `true`, the cursor points to the page before the position (newer commits). Otherwise, it points to the page
+	// after the position (older commits).
+	Prev bool
+}
+
+type cursorPayload struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+	Prev      bool   `json:"p,omitempty"`
+}
+
+// Returned by `DecodeCursor` when the cursor is malformed.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode a cursor as an opaque URL-safe token.
+func EncodeCursor(cursor Cursor) string {
+	b, _ := json.Marshal(cursorPayload{
+		CreatedAt: cursor.CreatedAt.UnixMilli(),
+		ID:        cursor.ID.Hex(),
+		Prev:      cursor.Prev,
+	})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode a cursor token created by `EncodeCursor`.
+func DecodeCursor(token string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(payload.ID)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{
+		CreatedAt: time.UnixMilli(payload.CreatedAt),
+		ID:        id,
+		Prev:      payload.Prev,
+	}, nil
+}
+
+// Returns a filter matching commits after the cursor's position in the order (created_at, _id) descending, or
+// before it if the cursor points to the previous page.
+func (cursor Cursor) Filter() bson.M {
+	op := "$lt"
+	if cursor.Prev {
+		op = "$gt"
+	}
+
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"created_at": bson.M{op: cursor.CreatedAt}},
+			bson.M{"created_at": cursor.CreatedAt, "_id": bson.M{op: cursor.ID}},
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package commit_lib
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Commit graph for tests, keyed by commit name. Each commit lists its index and the names of its parents.
+type testGraph map[string]struct {
+	index   int
+	parents []string
+}
+
+func (g testGraph) ids() map[string]primitive.ObjectID {
+	ids := make(map[string]primitive.ObjectID)
+	for name := range g {
+		ids[name] = primitive.NewObjectID()
+	}
+	return ids
+}
+
+// Returns a fetcher serving the graph, leaving out purged commits, and counting how often it's called.
+func (g testGraph) fetcher(ids map[string]primitive.ObjectID, purged []string, calls *int) graphNodeFetcher {
+	nodes := make(map[primitive.ObjectID]graphNode)
+	for name, commit := range g {
+		parentIDs := make([]primitive.ObjectID, len(commit.parents))
+		for i, parent := range commit.parents {
+			parentIDs[i] = ids[parent]
+		}
+		nodes[ids[name]] = graphNode{Index: commit.index, ParentIDs: parentIDs}
+	}
+	for _, name := range purged {
+		delete(nodes, ids[name])
+	}
+
+	return func(ctx context.Context, commitIDs []primitive.ObjectID) (map[primitive.ObjectID]graphNode, error) {
+		*calls++
+		result := make(map[primitive.ObjectID]graphNode)
+		for _, id := range commitIDs {
+			if node, ok := nodes[id]; ok {
+				result[id] = node
+			}
+		}
+		return result, nil
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	// root - c1 - c2 - c3 - c4          (main)
+	//         \         \
+	//          f1 - f2 - m1 - f3        (feature, m1 merges c3 into feature)
+	//                \
+	//                 x1                (other)
+	graph := testGraph{
+		"root": {1, nil},
+		"c1":   {2, []string{"root"}},
+		"f1":   {3, []string{"c1"}},
+		"c2":   {4, []string{"c1"}},
+		"f2":   {5, []string{"f1"}},
+		"c3":   {6, []string{"c2"}},
+		"x1":   {7, []string{"f2"}},
+		"m1":   {8, []string{"f2", "c3"}},
+		"c4":   {9, []string{"c3"}},
+		"f3":   {10, []string{"m1"}},
+		// Unrelated history, e.g. of an imported project
+		"u1": {11, nil},
+		"u2": {12, []string{"u1"}},
+	}
+
+	tests := []struct {
+		name   string
+		a, b   string
+		purged []string
+		ahead  int
+		behind int
+		base   string
+	}{
+		{name: "same commit", a: "c2", b: "c2", ahead: 0, behind: 0, base: "c2"},
+		{name: "fast-forward ahead", a: "c4", b: "c1", ahead: 3, behind: 0, base: "c1"},
+		{name: "fast-forward behind", a: "c1", b: "c4", ahead: 0, behind: 3, base: "c1"},
+		{name: "diverged", a: "f2", b: "c3", ahead: 2, behind: 2, base: "c1"},
+		{name: "merged base branch", a: "f3", b: "c3", ahead: 4, behind: 0, base: "c3"},
+		{name: "merged, base moved on", a: "f3", b: "c4", ahead: 4, behind: 1, base: "c3"},
+		{name: "sibling branches", a: "x1", b: "f3", ahead: 1, behind: 4, base: "f2"},
+		{name: "unrelated histories", a: "u2", b: "c2", ahead: 2, behind: 3, base: ""},
+		{name: "purged merge base", a: "f2", b: "c3", purged: []string{"c1"}, ahead: 2, behind: 2, base: ""},
+		{name: "purged ancestors below merge base", a: "f2", b: "c3", purged: []string{"root"}, ahead: 2, behind: 2, base: "c1"},
+		{name: "purged head", a: "f2", b: "c3", purged: []string{"c3"}, ahead: 4, behind: 0, base: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := graph.ids()
+			calls := 0
+			ahead, behind, baseID, err := aheadBehind(context.Background(), ids[tt.a], ids[tt.b], graph.fetcher(ids, tt.purged, &calls))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ahead != tt.ahead || behind != tt.behind {
+				t.Errorf("got ahead/behind %d/%d, want %d/%d", ahead, behind, tt.ahead, tt.behind)
+			}
+
+			wantBaseID := primitive.NilObjectID
+			if tt.base != "" {
+				wantBaseID = ids[tt.base]
+			}
+			if baseID != wantBaseID {
+				gotBase := "none"
+				for name, id := range ids {
+					if id == baseID {
+						gotBase = name
+					}
+				}
+				t.Errorf("got base %s, want %s", gotBase, tt.base)
+			}
+
+			// Every commit is fetched at most once, so there's at most one batch per commit in the graph
+			if calls > len(graph) {
+				t.Errorf("got %d fetches, want at most %d", calls, len(graph))
+			}
+		})
+	}
+}
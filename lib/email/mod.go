@@ -0,0 +1,52 @@
+package email
+
+import (
+	"fmt"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Send a plain text email from the no-reply address.
+func SendPlainText(toName string, toAddress string, subject string, body string) error {
+	m := sgmail.NewV3Mail()
+	m.SetFrom(sgmail.NewEmail("Decent", config.I.Email.NoReplyEmail))
+	m.Subject = subject
+	p := sgmail.NewPersonalization()
+	p.AddTos(sgmail.NewEmail(toName, toAddress))
+	m.AddPersonalizations(p)
+	m.AddContent(sgmail.NewContent("text/plain", body))
+
+	sgreq := sendgrid.GetRequest(config.I.Email.SendGridAPIKey, "/v3/mail/send", "https://api.sendgrid.com")
+	sgreq.Method = "POST"
+	sgreq.Body = sgmail.GetRequestBody(m)
+	res, err := sendgrid.API(sgreq)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("sendgrid responded with status %d: %s", res.StatusCode, res.Body)
+	}
+
+	return nil
+}
+
+// Send a plain text email to the primary address of a user.
+func SendPlainTextToUser(userID string, subject string, body string) error {
+	stytchUser, err := auth.GetStytchUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if len(stytchUser.Emails) == 0 {
+		return fmt.Errorf("user \"%s\" has no email address", userID)
+	}
+
+	return SendPlainText(
+		fmt.Sprintf("%s %s", stytchUser.Name.FirstName, stytchUser.Name.LastName),
+		stytchUser.Emails[0].Email,
+		subject,
+		body,
+	)
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// How long events are kept for clients to catch up on.
+const Retention = 7 * 24 * time.Hour
+
+// Max number of missed events sent to a client when it reconnects.
+const maxMissed = 1000
+
+// Send an event to a user.
+//
+// Events are stored, so they reach the user's streams on any server instance, and streams that reconnect receive the
+// events they missed.
+func Publish(userID string, eventType string, data interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = config.MI.DB.Collection("events").InsertOne(ctx, models.Event{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      encoded,
+	})
+	return err
+}
+
+// Watch a user's events as they're published.
+// The stream must be opened before getting missed events, so that no event is lost in between.
+func Watch(ctx context.Context, userID string) (*mongo.ChangeStream, error) {
+	return config.MI.DB.Collection("events").Watch(
+		ctx,
+		mongo.Pipeline{{{Key: "$match", Value: bson.M{
+			"operationType":        "insert",
+			"fullDocument.user_id": userID,
+		}}}},
+		options.ChangeStream().SetMaxAwaitTime(5*time.Second),
+	)
+}
+
+// Get a user's events published after the event with the given ID, oldest first.
+func GetMissed(ctx context.Context, userID string, afterID primitive.ObjectID) ([]models.Event, error) {
+	cur, err := config.MI.DB.Collection("events").Find(
+		ctx,
+		bson.M{"user_id": userID, "_id": bson.M{"$gt": afterID}},
+		options.Find().SetSort(bson.M{"_id": 1}).SetLimit(maxMissed),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var missed []models.Event
+	if err := cur.All(ctx, &missed); err != nil {
+		return nil, err
+	}
+	return missed, nil
+}
@@ -0,0 +1,166 @@
+// Lane assignment for drawing commit graphs, similar to `git log --graph`.
+//
+// Commits are laid out newest first. Each lane holds the ID of the commit expected next in it, so that a commit is
+// drawn in the lane of the child that references it as its first parent.
+package graph_lib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/decentvcs/server/lib/commit_lib"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Position in a commit graph, including the lane state needed to continue the layout on the next page.
+type Cursor struct {
+	Position commit_lib.Cursor
+	// Commit expected next in each lane. Free lanes are `primitive.NilObjectID`.
+	Lanes []primitive.ObjectID
+}
+
+type cursorPayload struct {
+	Position string   `json:"c"`
+	Lanes    []string `json:"l,omitempty"`
+}
+
+// Encode a cursor as an opaque URL-safe token.
+func EncodeCursor(cursor Cursor) string {
+	lanes := make([]string, len(cursor.Lanes))
+	for i, id := range cursor.Lanes {
+		if !id.IsZero() {
+			lanes[i] = id.Hex()
+		}
+	}
+
+	b, _ := json.Marshal(cursorPayload{
+		Position: commit_lib.EncodeCursor(cursor.Position),
+		Lanes:    lanes,
+	})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode a cursor token created by `EncodeCursor`.
+func DecodeCursor(token string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, commit_lib.ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return Cursor{}, commit_lib.ErrInvalidCursor
+	}
+
+	position, err := commit_lib.DecodeCursor(payload.Position)
+	if err != nil || position.Prev {
+		return Cursor{}, commit_lib.ErrInvalidCursor
+	}
+
+	lanes := make([]primitive.ObjectID, len(payload.Lanes))
+	for i, hex := range payload.Lanes {
+		if hex == "" {
+			continue
+		}
+
+		lanes[i], err = primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return Cursor{}, commit_lib.ErrInvalidCursor
+		}
+	}
+
+	return Cursor{Position: position, Lanes: lanes}, nil
+}
+
+// Assign lanes to commits ordered newest first, continuing from the given lane state.
+//
+// `inGraph` holds the IDs of parents that are part of the graph; edges to other parents get lane -1 and don't reserve
+// a lane. Returns the graph nodes and the lane state after the last commit.
+func AssignLanes(
+	commits []models.Commit,
+	inGraph map[primitive.ObjectID]bool,
+	lanes []primitive.ObjectID,
+) ([]models.GraphNode, []primitive.ObjectID) {
+	lanes = append([]primitive.ObjectID{}, lanes...)
+	nodes := make([]models.GraphNode, 0, len(commits))
+
+	for _, commit := range commits {
+		// Use the first lane expecting this commit; other lanes expecting it merge into it
+		lane := -1
+		for i, id := range lanes {
+			if id == commit.ID {
+				if lane == -1 {
+					lane = i
+				} else {
+					lanes[i] = primitive.NilObjectID
+				}
+			}
+		}
+		if lane == -1 {
+			lane = freeLane(&lanes)
+		}
+		lanes[lane] = primitive.NilObjectID
+
+		// Reserve lanes for parents. The first parent continues in this commit's lane.
+		parents := make([]models.GraphEdge, 0, len(commit.ParentIDs))
+		for i, parentID := range commit.ParentIDs {
+			if !inGraph[parentID] {
+				parents = append(parents, models.GraphEdge{ID: parentID, Lane: -1})
+				continue
+			}
+
+			parentLane := indexOf(lanes, parentID)
+			if parentLane == -1 {
+				if i == 0 {
+					parentLane = lane
+				} else {
+					parentLane = freeLane(&lanes)
+				}
+				lanes[parentLane] = parentID
+			}
+			parents = append(parents, models.GraphEdge{ID: parentID, Lane: parentLane})
+		}
+
+		nodes = append(nodes, models.GraphNode{
+			ID:        commit.ID,
+			CreatedAt: commit.CreatedAt,
+			Index:     commit.Index,
+			BranchID:  commit.BranchID,
+			Message:   commit.Message,
+			AuthorID:  commit.AuthorID,
+			Lane:      lane,
+			Parents:   parents,
+		})
+	}
+
+	// Drop free lanes at the end
+	for len(lanes) > 0 && lanes[len(lanes)-1].IsZero() {
+		lanes = lanes[:len(lanes)-1]
+	}
+
+	return nodes, lanes
+}
+
+// Returns the first free lane, adding one if all are taken.
+func freeLane(lanes *[]primitive.ObjectID) int {
+	for i, id := range *lanes {
+		if id.IsZero() {
+			return i
+		}
+	}
+
+	*lanes = append(*lanes, primitive.NilObjectID)
+	return len(*lanes) - 1
+}
+
+// Returns the index of the lane expecting the given commit, or -1 if there is none.
+func indexOf(lanes []primitive.ObjectID, commitID primitive.ObjectID) int {
+	for i, id := range lanes {
+		if id == commitID {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Hard-delete branches that were soft-deleted longer than the retention period ago, along with their reflogs, locks and
+// the commits made on them that are no longer part of any other history.
+func purgeDeletedBranches() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cutoff := time.Now().AddDate(0, 0, -config.I.BranchRetentionDays)
+	branchIDs, err := config.MI.DB.Collection("branches").Distinct(ctx, "_id", bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		fmt.Printf("[purgeDeletedBranches] Error getting deleted branches: %v\n", err)
+		return
+	}
+	if len(branchIDs) == 0 {
+		return
+	}
+
+	// Delete everything belonging to the branches before the branches themselves, so that if any step fails, the next run
+	// finds the branches again and picks up where this one left off
+	count, err := purgeCommits(ctx, bson.M{"branch_id": bson.M{"$in": branchIDs}}, branchIDs)
+	if err != nil {
+		fmt.Printf("[purgeDeletedBranches] Error purging commits: %v\n", err)
+		return
+	}
+	if count > 0 {
+		fmt.Printf("[purgeDeletedBranches] Purged %d commits\n", count)
+	}
+
+	for _, collection := range []string{"reflog", "locks", "unlock_requests"} {
+		if _, err := config.MI.DB.Collection(collection).DeleteMany(ctx, bson.M{"branch_id": bson.M{"$in": branchIDs}}); err != nil {
+			fmt.Printf("[purgeDeletedBranches] Error deleting %s: %v\n", collection, err)
+			return
+		}
+	}
+
+	res, err := config.MI.DB.Collection("branches").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": branchIDs}, "deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		fmt.Printf("[purgeDeletedBranches] Error deleting branches: %v\n", err)
+		return
+	}
+	fmt.Printf("[purgeDeletedBranches] Purged %d branches\n", res.DeletedCount)
+}
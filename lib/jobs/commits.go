@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Hard-delete commits that were soft-deleted longer than the retention period ago.
+func purgeDeletedCommits() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cutoff := time.Now().AddDate(0, 0, -config.I.CommitRetentionDays)
+	count, err := purgeCommits(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}}, nil)
+	if err != nil {
+		fmt.Printf("[purgeDeletedCommits] Error purging commits: %v\n", err)
+		return
+	}
+
+	if count > 0 {
+		fmt.Printf("[purgeDeletedCommits] Purged %d commits\n", count)
+	}
+}
+
+// Hard-delete the commits matching the filter.
+//
+// Commits that are still referenced by a branch, a tag, or a commit that isn't being purged are kept, since they're
+// part of some other history. References from the branches in `purgedBranchIDs` are ignored, since those branches are
+// being purged too. Returns the number of deleted commits.
+func purgeCommits(ctx context.Context, filter bson.M, purgedBranchIDs []interface{}) (int64, error) {
+	cur, err := config.MI.DB.Collection("commits").Find(
+		ctx,
+		filter,
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get commits: %v", err)
+	}
+
+	var commits []models.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		return 0, fmt.Errorf("failed to decode commits: %v", err)
+	}
+
+	candidates := make(map[primitive.ObjectID]bool, len(commits))
+	for _, commit := range commits {
+		candidates[commit.ID] = true
+	}
+
+	// Keep removing referenced candidates until none are left, since keeping a commit also keeps its ancestors
+	for len(candidates) > 0 {
+		ids := lo.Keys(candidates)
+
+		branchFilter := bson.M{"commit_id": bson.M{"$in": ids}}
+		if len(purgedBranchIDs) > 0 {
+			branchFilter["_id"] = bson.M{"$nin": purgedBranchIDs}
+		}
+
+		var referenced []interface{}
+		for _, query := range []struct {
+			collection string
+			field      string
+			filter     bson.M
+		}{
+			{"branches", "commit_id", branchFilter},
+			{"tags", "commit_id", bson.M{"commit_id": bson.M{"$in": ids}}},
+			{"commits", "parent_ids", bson.M{"parent_ids": bson.M{"$in": ids}, "_id": bson.M{"$nin": ids}}},
+		} {
+			values, err := config.MI.DB.Collection(query.collection).Distinct(ctx, query.field, query.filter)
+			if err != nil {
+				return 0, fmt.Errorf("failed to get references from %s: %v", query.collection, err)
+			}
+			referenced = append(referenced, values...)
+		}
+
+		removed := 0
+		for _, value := range referenced {
+			if id, ok := value.(primitive.ObjectID); ok && candidates[id] {
+				delete(candidates, id)
+				removed++
+			}
+		}
+
+		if removed == 0 {
+			break
+		}
+	}
+
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	res, err := config.MI.DB.Collection("commits").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": lo.Keys(candidates)}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete commits: %v", err)
+	}
+
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/email"
+	"github.com/decentvcs/server/lib/lock_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/samber/lo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Release locks that have expired.
+func releaseExpiredLocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	filter := bson.M{"expires_at": bson.M{"$lte": time.Now()}}
+	lockIDs, err := config.MI.DB.Collection("locks").Distinct(ctx, "_id", filter)
+	if err != nil {
+		fmt.Printf("[releaseExpiredLocks] Error getting locks: %v\n", err)
+		return
+	}
+	if len(lockIDs) == 0 {
+		return
+	}
+
+	// Locks renewed in the meantime no longer match the filter and are kept
+	filter["_id"] = bson.M{"$in": lockIDs}
+	res, err := config.MI.DB.Collection("locks").DeleteMany(ctx, filter)
+	if err != nil {
+		fmt.Printf("[releaseExpiredLocks] Error deleting locks: %v\n", err)
+		return
+	}
+
+	if res.DeletedCount > 0 {
+		fmt.Printf("[releaseExpiredLocks] Released %d locks\n", res.DeletedCount)
+	}
+
+	// Cancel unlock requests for the locks that were actually released
+	kept, err := config.MI.DB.Collection("locks").Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": lockIDs}})
+	if err != nil {
+		fmt.Printf("[releaseExpiredLocks] Error getting kept locks: %v\n", err)
+		return
+	}
+	toObjectIDs := func(ids []interface{}) []primitive.ObjectID {
+		return lo.Map(ids, func(id interface{}, _ int) primitive.ObjectID { return id.(primitive.ObjectID) })
+	}
+	released, _ := lo.Difference(toObjectIDs(lockIDs), toObjectIDs(kept))
+	if err := lock_lib.CancelUnlockRequests(ctx, released); err != nil {
+		fmt.Printf("[releaseExpiredLocks] Error cancelling unlock requests: %v\n", err)
+	}
+}
+
+// Notify holders of locks that expire within the warning period, so they can renew them if they're still editing the
+// files. Each lock is only warned about once until it's renewed.
+//
+// The job runs on every server instance, so each lock is claimed by setting its warning time before notifying its
+// holder, and only the instance that claimed it sends the warning.
+func warnExpiringLocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"expires_at": bson.M{
+			"$gt":  now,
+			"$lte": now.Add(time.Duration(config.I.LockExpiryWarningMinutes) * time.Minute),
+		},
+		"expiry_warned_at": bson.M{"$exists": false},
+	}
+	cur, err := config.MI.DB.Collection("locks").Find(ctx, filter)
+	if err != nil {
+		fmt.Printf("[warnExpiringLocks] Error getting locks: %v\n", err)
+		return
+	}
+
+	var candidates []models.Lock
+	if err := cur.All(ctx, &candidates); err != nil {
+		fmt.Printf("[warnExpiringLocks] Error decoding locks: %v\n", err)
+		return
+	}
+
+	// Claim locks that no other instance claimed in the meantime
+	var locks []models.Lock
+	for _, lock := range candidates {
+		filter["_id"] = lock.ID
+		res, err := config.MI.DB.Collection("locks").UpdateOne(ctx, filter, bson.M{"$set": bson.M{"expiry_warned_at": now}})
+		if err != nil {
+			fmt.Printf("[warnExpiringLocks] Error claiming lock: %v\n", err)
+			continue
+		}
+		if res.ModifiedCount == 1 {
+			locks = append(locks, lock)
+		}
+	}
+	if len(locks) == 0 {
+		return
+	}
+
+	// Get names of the locks' branches and projects
+	branchNames, err := getNames(ctx, "branches", lo.Uniq(lo.Map(locks, func(lock models.Lock, _ int) primitive.ObjectID { return lock.BranchID })))
+	if err != nil {
+		fmt.Printf("[warnExpiringLocks] Error getting branches: %v\n", err)
+		return
+	}
+	projectNames, err := getNames(ctx, "projects", lo.Uniq(lo.Map(locks, func(lock models.Lock, _ int) primitive.ObjectID { return lock.ProjectID })))
+	if err != nil {
+		fmt.Printf("[warnExpiringLocks] Error getting projects: %v\n", err)
+		return
+	}
+
+	for userID, userLocks := range lo.GroupBy(locks, func(lock models.Lock) string { return lock.UserID }) {
+		lines := make([]string, len(userLocks))
+		for i, lock := range userLocks {
+			lines[i] = fmt.Sprintf(
+				"  %s/%s: %s (expires %s)",
+				projectNames[lock.ProjectID],
+				branchNames[lock.BranchID],
+				lock.Path,
+				lock.ExpiresAt.UTC().Format("2006-01-02 15:04 MST"),
+			)
+		}
+		sort.Strings(lines)
+
+		body := "The following file locks you hold are about to expire:\n\n" +
+			strings.Join(lines, "\n") +
+			"\n\nIf you're still editing these files, renew the locks from your client. Otherwise, they'll be released " +
+			"automatically when they expire.\n"
+		if err := email.SendPlainTextToUser(userID, "Your file locks are about to expire", body); err != nil {
+			fmt.Printf("[warnExpiringLocks] Error notifying user \"%s\": %v\n", userID, err)
+
+			// Release claims so the warning is retried on the next run
+			lockIDs := lo.Map(userLocks, func(lock models.Lock, _ int) primitive.ObjectID { return lock.ID })
+			if _, err := config.MI.DB.Collection("locks").UpdateMany(
+				ctx,
+				bson.M{"_id": bson.M{"$in": lockIDs}, "expiry_warned_at": now},
+				bson.M{"$unset": bson.M{"expiry_warned_at": ""}},
+			); err != nil {
+				fmt.Printf("[warnExpiringLocks] Error releasing locks: %v\n", err)
+			}
+		}
+	}
+}
+
+// Get the names of documents in a collection by their IDs.
+func getNames(ctx context.Context, collection string, ids []primitive.ObjectID) (map[primitive.ObjectID]string, error) {
+	cur, err := config.MI.DB.Collection(collection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Name string             `bson:"name"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(docs))
+	for _, doc := range docs {
+		names[doc.ID] = doc.Name
+	}
+
+	return names, nil
+}
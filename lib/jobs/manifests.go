@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/lib/manifest_lib"
+)
+
+// Delete manifests and chunks left behind by purged commits, branches and projects.
+func purgeUnreferencedManifests() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Recently written manifests may belong to commits that are still being created
+	manifests, chunks, err := manifest_lib.Sweep(ctx, time.Now().Add(-time.Hour))
+	if err != nil {
+		fmt.Printf("[purgeUnreferencedManifests] Error purging manifests: %v\n", err)
+		return
+	}
+
+	if manifests > 0 || chunks > 0 {
+		fmt.Printf("[purgeUnreferencedManifests] Purged %d manifests and %d chunks\n", manifests, chunks)
+	}
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"log"
+
+	"github.com/decentvcs/server/config"
+)
+
+// Register all scheduled jobs and start the scheduler in the background.
+// NOTE: This should only ever be called once (at the start of the app), after the database is initialized.
+func Start() {
+	if _, err := config.I.Scheduler.Every(1).Hour().Do(purgeDeletedCommits); err != nil {
+		log.Fatalf("[jobs] Error scheduling \"purgeDeletedCommits\": %v", err)
+	}
+	if _, err := config.I.Scheduler.Every(1).Hour().Do(purgeDeletedBranches); err != nil {
+		log.Fatalf("[jobs] Error scheduling \"purgeDeletedBranches\": %v", err)
+	}
+	if _, err := config.I.Scheduler.Every(1).Hour().Do(purgeUnreferencedManifests); err != nil {
+		log.Fatalf("[jobs] Error scheduling \"purgeUnreferencedManifests\": %v", err)
+	}
+
+	if _, err := config.I.Scheduler.Every(1).Minute().Do(releaseExpiredLocks); err != nil {
+		log.Fatalf("[jobs] Error scheduling \"releaseExpiredLocks\": %v", err)
+	}
+	if _, err := config.I.Scheduler.Every(1).Minute().Do(warnExpiringLocks); err != nil {
+		log.Fatalf("[jobs] Error scheduling \"warnExpiringLocks\": %v", err)
+	}
+
+	config.I.Scheduler.StartAsync()
+}
@@ -0,0 +1,260 @@
+package lock_lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Filter matching locks that haven't expired yet.
+func ActiveFilter() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"expires_at": bson.M{"$exists": false}},
+		{"expires_at": bson.M{"$gt": time.Now()}},
+	}}
+}
+
+// Get the active locks of a branch.
+func GetMany(ctx context.Context, branchID primitive.ObjectID) ([]models.Lock, error) {
+	cur, err := config.MI.DB.Collection("locks").Find(
+		ctx,
+		bson.M{"branch_id": branchID, "$and": []bson.M{ActiveFilter()}},
+		options.Find().SetSort(bson.M{"path": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	locks := []models.Lock{}
+	if err := cur.All(ctx, &locks); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+// Get the active locks of a branch as a map of file path to the ID of the user holding the lock.
+func GetMap(ctx context.Context, branchID primitive.ObjectID) (map[string]string, error) {
+	locks, err := GetMany(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(locks))
+	for _, lock := range locks {
+		result[lock.Path] = lock.UserID
+	}
+
+	return result, nil
+}
+
+// Aggregation stages that set the "locks" field of branch documents to a map of file path to the ID of the user
+// holding the lock, like `GetMap`.
+func LookupStages() []bson.M {
+	return []bson.M{
+		{
+			"$lookup": bson.M{
+				"from": "locks",
+				"let":  bson.M{"branch_id": "$_id"},
+				"pipeline": []bson.M{
+					{"$match": bson.M{"$expr": bson.M{"$eq": []string{"$branch_id", "$$branch_id"}}}},
+					{"$match": ActiveFilter()},
+				},
+				"as": "locks",
+			},
+		},
+		{
+			"$set": bson.M{
+				"locks": bson.M{
+					"$arrayToObject": bson.M{
+						"$map": bson.M{
+							"input": "$locks",
+							"in":    bson.M{"k": "$$this.path", "v": "$$this.user_id"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Returned by `Acquire` when one of the paths is already locked.
+type LockedError struct {
+	Path string
+	// ID of the user holding the lock. Empty if the lock was released in the meantime.
+	UserID string
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("path \"%s\" is already locked", e.Path)
+}
+
+// Acquire all of the given locks of a branch, or none of them.
+//
+// The unique index on branch and path guarantees that only one lock per path is ever held, so concurrent requests
+// can't overwrite each other's locks. Expired locks on the same paths are replaced. Returns a `*LockedError` if any
+// path is already locked.
+func Acquire(ctx context.Context, branchID primitive.ObjectID, locks []models.Lock) error {
+	paths := make([]string, len(locks))
+	for i, lock := range locks {
+		paths[i] = lock.Path
+	}
+
+	session, err := config.MI.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := config.MI.DB.Collection("locks").DeleteMany(sc, bson.M{
+			"branch_id":  branchID,
+			"path":       bson.M{"$in": paths},
+			"expires_at": bson.M{"$lte": time.Now()},
+		}); err != nil {
+			return nil, err
+		}
+
+		docs := make([]interface{}, len(locks))
+		for i, lock := range locks {
+			docs[i] = lock
+		}
+
+		_, err := config.MI.DB.Collection("locks").InsertMany(sc, docs)
+		return nil, err
+	})
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && mongo.IsDuplicateKeyError(err) && len(bulkErr.WriteErrors) > 0 {
+		lockedErr := &LockedError{Path: locks[bulkErr.WriteErrors[0].Index].Path}
+
+		var holder models.Lock
+		if err := config.MI.DB.Collection("locks").FindOne(ctx, bson.M{"branch_id": branchID, "path": lockedErr.Path}).Decode(&holder); err == nil {
+			lockedErr.UserID = holder.UserID
+		}
+
+		return lockedErr
+	}
+
+	return err
+}
+
+// Release locks of a branch. `holders` maps each path to the ID of the user expected to hold its lock; a path's lock
+// is only released if it is still held by that user, so a lock acquired by someone else in the meantime is kept.
+// Pending unlock requests for the released locks are cancelled.
+//
+// Returns the released locks.
+func Release(ctx context.Context, branchID primitive.ObjectID, holders map[string]string) ([]models.Lock, error) {
+	released := []models.Lock{}
+	for path, userID := range holders {
+		var lock models.Lock
+		if err := config.MI.DB.Collection("locks").FindOneAndDelete(ctx, bson.M{
+			"branch_id": branchID,
+			"path":      path,
+			"user_id":   userID,
+		}).Decode(&lock); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		released = append(released, lock)
+	}
+
+	lockIDs := make([]primitive.ObjectID, len(released))
+	for i, lock := range released {
+		lockIDs[i] = lock.ID
+	}
+	if err := CancelUnlockRequests(ctx, lockIDs); err != nil {
+		return nil, err
+	}
+
+	return released, nil
+}
+
+// Cancel the pending unlock requests for the given locks, e.g. because the locks were released.
+func CancelUnlockRequests(ctx context.Context, lockIDs []primitive.ObjectID) error {
+	if len(lockIDs) == 0 {
+		return nil
+	}
+
+	_, err := config.MI.DB.Collection("unlock_requests").UpdateMany(
+		ctx,
+		bson.M{"lock_id": bson.M{"$in": lockIDs}, "status": models.UnlockRequestStatusPending},
+		bson.M{"$set": bson.M{"status": models.UnlockRequestStatusCancelled, "resolved_at": time.Now()}},
+	)
+	return err
+}
+
+// Extend the expiry of the active, expiring locks matching the filter to `ttlMinutes` from now, or to each lock's own
+// TTL if `ttlMinutes` is 0. Locks that don't expire are left alone.
+//
+// Returns the number of renewed locks.
+func Renew(ctx context.Context, filter bson.M, ttlMinutes int) (int64, error) {
+	filter["expires_at"] = bson.M{"$gt": time.Now()}
+
+	var ttl interface{} = "$ttl_minutes"
+	if ttlMinutes > 0 {
+		ttl = ttlMinutes
+	} else {
+		filter["ttl_minutes"] = bson.M{"$gt": 0}
+	}
+
+	res, err := config.MI.DB.Collection("locks").UpdateMany(ctx, filter, []bson.M{
+		{"$set": bson.M{
+			"ttl_minutes": ttl,
+			"expires_at":  bson.M{"$add": []interface{}{"$$NOW", bson.M{"$multiply": []interface{}{ttl, 60 * 1000}}}},
+		}},
+		{"$unset": "expiry_warned_at"},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.MatchedCount, nil
+}
+
+// Check whether a file path matches any of a project's exclusive checkout patterns. Patterns without a slash are
+// matched against the file name, so that e.g. "*.psd" matches PSD files in any directory.
+func RequiresExclusiveCheckout(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		target := p
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(p)
+		}
+
+		if ok, err := path.Match(pattern, target); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get the paths that require exclusive checkout but aren't locked by the user, given a branch's map of locks.
+func UnheldExclusivePaths(patterns []string, locks map[string]string, userID string, paths []string) []string {
+	unheld := []string{}
+	if len(patterns) == 0 {
+		return unheld
+	}
+
+	for _, p := range paths {
+		if RequiresExclusiveCheckout(patterns, p) && locks[p] != userID {
+			unheld = append(unheld, p)
+		}
+	}
+
+	return unheld
+}
@@ -0,0 +1,602 @@
+// Manifests describe the full file state of a commit. They are stored separately from commits so that commit
+// documents stay small regardless of project size.
+//
+// A manifest is split into chunks, each holding some of the files of a single directory. Large directories are split
+// into several chunks at paths chosen by their hash, so that adding a file only rewrites the chunk it falls into. Both
+// chunks and manifest roots are content-addressed, so a new commit only writes chunks for the directories it changed
+// and shares all other chunks with its parent.
+package manifest_lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A directory's entries are split into a new chunk after each path whose hash starts with a zero byte, so chunks hold
+// 256 entries on average.
+const chunkBoundaryByte = 0
+
+// Max approximate size of a chunk in bytes. Chunks are also split when they reach it, keeping them well below the
+// 16 MB document size limit even when entries have long patch histories.
+const maxChunkSize = 4 << 20
+
+// Returns the hexadecimal SHA-256 hash of the JSON serialization of `v`.
+func hashOf(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get a manifest root by ID. An empty ID refers to the empty manifest.
+func getRoot(ctx context.Context, manifestID string) (*models.Manifest, error) {
+	if manifestID == "" {
+		return &models.Manifest{}, nil
+	}
+
+	var root models.Manifest
+	if err := config.MI.DB.Collection("manifests").FindOne(ctx, bson.M{"_id": manifestID}).Decode(&root); err != nil {
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// Get many chunks by ID, mapped by ID.
+func getChunks(ctx context.Context, chunkIDs []string) (map[string]models.ManifestChunk, error) {
+	chunks := make(map[string]models.ManifestChunk, len(chunkIDs))
+	if len(chunkIDs) == 0 {
+		return chunks, nil
+	}
+
+	cur, err := config.MI.DB.Collection("manifest_chunks").Find(ctx, bson.M{"_id": bson.M{"$in": chunkIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var chunk models.ManifestChunk
+		if err := cur.Decode(&chunk); err != nil {
+			return nil, err
+		}
+		chunks[chunk.ID] = chunk
+	}
+
+	for _, id := range chunkIDs {
+		if _, ok := chunks[id]; !ok {
+			return nil, errors.New("manifest chunk not found: " + id)
+		}
+	}
+
+	return chunks, nil
+}
+
+// Load the file entries of the given directories of a manifest.
+// If `dirs` is nil, all directories are loaded.
+func load(ctx context.Context, manifestID string, dirs map[string]bool) (map[string]models.FileData, error) {
+	root, err := getRoot(ctx, manifestID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunkIDs []string
+	for _, ref := range root.Chunks {
+		if dirs == nil || dirs[ref.Dir] {
+			chunkIDs = append(chunkIDs, ref.ChunkID)
+		}
+	}
+
+	chunks, err := getChunks(ctx, chunkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]models.FileData)
+	for _, chunk := range chunks {
+		for _, entry := range chunk.Entries {
+			files[entry.Path] = entry.Data
+		}
+	}
+
+	return files, nil
+}
+
+// Materialize the full file map of a manifest.
+func Load(ctx context.Context, manifestID string) (map[string]models.FileData, error) {
+	return load(ctx, manifestID, nil)
+}
+
+// Materialize the file map of a manifest, limited to the given paths.
+// Only the chunks containing those paths are loaded.
+func LoadPaths(ctx context.Context, manifestID string, paths []string) (map[string]models.FileData, error) {
+	dirs := make(map[string]bool)
+	for _, p := range paths {
+		dirs[path.Dir(p)] = true
+	}
+
+	files, err := load(ctx, manifestID, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	for p := range files {
+		if !wanted[p] {
+			delete(files, p)
+		}
+	}
+
+	return files, nil
+}
+
+// Returns true if both file data entries reference the same file contents.
+func FileDataEqual(a models.FileData, b models.FileData) bool {
+	if a.Hash != b.Hash || a.Version != b.Version || len(a.PatchHashes) != len(b.PatchHashes) {
+		return false
+	}
+
+	for i := range a.PatchHashes {
+		if a.PatchHashes[i] != b.PatchHashes[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Compute the net changes from one manifest to another.
+// Only the chunks that differ between the manifests are loaded.
+func Diff(ctx context.Context, fromManifestID string, toManifestID string) (*models.ManifestDiff, error) {
+	diff := &models.ManifestDiff{
+		Created:  make(map[string]models.FileData),
+		Modified: make(map[string]models.FileData),
+		Deleted:  []string{},
+	}
+	if fromManifestID == toManifestID {
+		return diff, nil
+	}
+
+	fromRoot, err := getRoot(ctx, fromManifestID)
+	if err != nil {
+		return nil, err
+	}
+	toRoot, err := getRoot(ctx, toManifestID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks in both manifests hold identical entries, and every path is in a single chunk per manifest, so only the
+	// chunks that aren't shared need to be compared
+	fromChunkIDs := make(map[string]bool, len(fromRoot.Chunks))
+	for _, ref := range fromRoot.Chunks {
+		fromChunkIDs[ref.ChunkID] = true
+	}
+	toChunkIDs := make(map[string]bool, len(toRoot.Chunks))
+	for _, ref := range toRoot.Chunks {
+		toChunkIDs[ref.ChunkID] = true
+	}
+
+	var chunkIDs []string
+	for id := range fromChunkIDs {
+		if !toChunkIDs[id] {
+			chunkIDs = append(chunkIDs, id)
+		}
+	}
+	for id := range toChunkIDs {
+		if !fromChunkIDs[id] {
+			chunkIDs = append(chunkIDs, id)
+		}
+	}
+
+	chunks, err := getChunks(ctx, chunkIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	fromFiles := make(map[string]models.FileData)
+	toFiles := make(map[string]models.FileData)
+	for id, chunk := range chunks {
+		files := toFiles
+		if fromChunkIDs[id] {
+			files = fromFiles
+		}
+		for _, entry := range chunk.Entries {
+			files[entry.Path] = entry.Data
+		}
+	}
+
+	for p, data := range toFiles {
+		if before, ok := fromFiles[p]; !ok {
+			diff.Created[p] = data
+		} else if !FileDataEqual(before, data) {
+			diff.Modified[p] = data
+		}
+	}
+	for p := range fromFiles {
+		if _, ok := toFiles[p]; !ok {
+			diff.Deleted = append(diff.Deleted, p)
+		}
+	}
+	sort.Strings(diff.Deleted)
+
+	return diff, nil
+}
+
+// Get the unique storage object hashes (including patch hashes) referenced by any of the given manifests.
+func ObjectHashes(ctx context.Context, manifestIDs []string) ([]string, error) {
+	// Collect unique chunk IDs, since most chunks are shared between manifests
+	chunkIDs := make(map[string]bool)
+	for _, id := range manifestIDs {
+		root, err := getRoot(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range root.Chunks {
+			chunkIDs[ref.ChunkID] = true
+		}
+	}
+
+	ids := make([]string, 0, len(chunkIDs))
+	for id := range chunkIDs {
+		ids = append(ids, id)
+	}
+
+	chunks, err := getChunks(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var hashes []string
+	for _, chunk := range chunks {
+		for _, entry := range chunk.Entries {
+			for _, hash := range append([]string{entry.Data.Hash}, entry.Data.PatchHashes...) {
+				if hash != "" && !seen[hash] {
+					seen[hash] = true
+					hashes = append(hashes, hash)
+				}
+			}
+		}
+	}
+
+	return hashes, nil
+}
+
+// Store a full file map as a new manifest.
+//
+// Returns the manifest ID.
+func Store(ctx context.Context, files map[string]models.FileData) (string, error) {
+	return Apply(ctx, "", files, nil)
+}
+
+// Create a manifest from an existing one by upserting and deleting file entries.
+// Only the chunks of directories touched by the changes are loaded and written.
+//
+// Returns the new manifest ID.
+func Apply(ctx context.Context, baseManifestID string, upserts map[string]models.FileData, deletes []string) (string, error) {
+	root, err := getRoot(ctx, baseManifestID)
+	if err != nil {
+		return "", err
+	}
+
+	// Map of directory to the IDs of its chunks, in path order
+	refs := make(map[string][]string)
+	for _, ref := range root.Chunks {
+		refs[ref.Dir] = append(refs[ref.Dir], ref.ChunkID)
+	}
+
+	// Load the chunks of all touched directories
+	touched := make(map[string]bool)
+	for p := range upserts {
+		touched[path.Dir(p)] = true
+	}
+	for _, p := range deletes {
+		touched[path.Dir(p)] = true
+	}
+
+	var existingChunkIDs []string
+	for dir := range touched {
+		existingChunkIDs = append(existingChunkIDs, refs[dir]...)
+	}
+
+	existingChunks, err := getChunks(ctx, existingChunkIDs)
+	if err != nil {
+		return "", err
+	}
+
+	entriesByDir := make(map[string]map[string]models.FileData, len(touched))
+	for dir := range touched {
+		entries := make(map[string]models.FileData)
+		for _, id := range refs[dir] {
+			for _, entry := range existingChunks[id].Entries {
+				entries[entry.Path] = entry.Data
+			}
+		}
+		entriesByDir[dir] = entries
+	}
+
+	// Apply changes
+	for _, p := range deletes {
+		delete(entriesByDir[path.Dir(p)], p)
+	}
+	for p, data := range upserts {
+		entriesByDir[path.Dir(p)][p] = data
+	}
+
+	// Build new chunks
+	var written []models.ManifestChunk
+	for dir, entries := range entriesByDir {
+		if len(entries) == 0 {
+			delete(refs, dir)
+			continue
+		}
+
+		chunks, err := newChunks(entries)
+		if err != nil {
+			return "", err
+		}
+		refs[dir] = nil
+		for _, chunk := range chunks {
+			refs[dir] = append(refs[dir], chunk.ID)
+		}
+		written = append(written, chunks...)
+	}
+
+	newRoot, err := newManifest(refs)
+	if err != nil {
+		return "", err
+	}
+
+	if err := write(ctx, written, newRoot); err != nil {
+		return "", err
+	}
+
+	return newRoot.ID, nil
+}
+
+// Build content-addressed chunks from the file entries of a directory.
+func newChunks(files map[string]models.FileData) ([]models.ManifestChunk, error) {
+	entries := make([]models.ManifestEntry, 0, len(files))
+	for p, data := range files {
+		entries = append(entries, models.ManifestEntry{Path: p, Data: data})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	var chunks []models.ManifestChunk
+	start, size := 0, 0
+	for i, entry := range entries {
+		entrySize := entrySize(entry)
+		if i > start && size+entrySize > maxChunkSize {
+			chunk, err := newChunk(entries[start:i])
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunk)
+			start, size = i, 0
+		}
+		size += entrySize
+
+		if sha256.Sum256([]byte(entry.Path))[0] == chunkBoundaryByte || i == len(entries)-1 {
+			chunk, err := newChunk(entries[start : i+1])
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunk)
+			start, size = i+1, 0
+		}
+	}
+
+	return chunks, nil
+}
+
+// Approximate size of an encoded entry in bytes.
+func entrySize(entry models.ManifestEntry) int {
+	size := 64 + len(entry.Path) + len(entry.Data.Hash)
+	for _, hash := range entry.Data.PatchHashes {
+		size += 8 + len(hash)
+	}
+	return size
+}
+
+// Build a content-addressed chunk from entries sorted by path.
+func newChunk(entries []models.ManifestEntry) (models.ManifestChunk, error) {
+	id, err := hashOf(entries)
+	if err != nil {
+		return models.ManifestChunk{}, err
+	}
+
+	return models.ManifestChunk{ID: id, Entries: entries}, nil
+}
+
+// Build a content-addressed manifest root from a map of directory to the IDs of its chunks in path order.
+func newManifest(refs map[string][]string) (models.Manifest, error) {
+	dirs := make([]string, 0, len(refs))
+	for dir := range refs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	chunks := []models.ManifestChunkRef{}
+	for _, dir := range dirs {
+		for _, id := range refs[dir] {
+			chunks = append(chunks, models.ManifestChunkRef{Dir: dir, ChunkID: id})
+		}
+	}
+
+	id, err := hashOf(chunks)
+	if err != nil {
+		return models.Manifest{}, err
+	}
+
+	return models.Manifest{ID: id, Chunks: chunks}, nil
+}
+
+// Insert chunks and manifest root, skipping any that already exist.
+//
+// Both are marked as written now, even if they already existed, so that a concurrent sweep doesn't delete them before
+// the commit referencing them is created.
+func write(ctx context.Context, chunks []models.ManifestChunk, root models.Manifest) error {
+	now := time.Now()
+
+	if len(chunks) > 0 {
+		writes := make([]mongo.WriteModel, 0, len(chunks))
+		for _, chunk := range chunks {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": chunk.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"written_at": now}, "$setOnInsert": bson.M{"entries": chunk.Entries}}).
+				SetUpsert(true))
+		}
+
+		// Duplicate key errors mean a concurrent request inserted the same chunk, which is fine since chunks are
+		// content-addressed
+		if _, err := config.MI.DB.Collection("manifest_chunks").BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	if _, err := config.MI.DB.Collection("manifests").UpdateOne(
+		ctx,
+		bson.M{"_id": root.ID},
+		bson.M{"$set": bson.M{"written_at": now}, "$setOnInsert": bson.M{"chunks": root.Chunks}},
+		options.Update().SetUpsert(true),
+	); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Max number of IDs per delete query.
+const sweepBatchSize = 1000
+
+// Delete manifests that no commit references, then chunks that no remaining manifest references.
+//
+// Chunks are shared across projects, so they can only be deleted once nothing references them anywhere. Manifests and
+// chunks written after `writtenBefore` are kept, since the commits referencing them may not have been created yet.
+// Returns the number of deleted manifests and chunks.
+func Sweep(ctx context.Context, writtenBefore time.Time) (int64, int64, error) {
+	// Mark manifests referenced by commits, including soft-deleted ones
+	commitCur, err := config.MI.DB.Collection("commits").Find(
+		ctx,
+		bson.M{"manifest_id": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"manifest_id": 1}),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer commitCur.Close(ctx)
+
+	referencedManifests := make(map[string]bool)
+	for commitCur.Next(ctx) {
+		var commit models.Commit
+		if err := commitCur.Decode(&commit); err != nil {
+			return 0, 0, err
+		}
+		referencedManifests[commit.ManifestID] = true
+	}
+	if err := commitCur.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// Manifests and chunks written before marking was introduced have no written time
+	oldFilter := bson.M{"written_at": bson.M{"$not": bson.M{"$gte": writtenBefore}}}
+
+	deletedManifests, err := sweepCollection(ctx, "manifests", oldFilter, referencedManifests)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Mark chunks referenced by the remaining manifests
+	cur, err := config.MI.DB.Collection("manifests").Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"chunks.chunk_id": 1}))
+	if err != nil {
+		return deletedManifests, 0, err
+	}
+	defer cur.Close(ctx)
+
+	referencedChunks := make(map[string]bool)
+	for cur.Next(ctx) {
+		var manifest models.Manifest
+		if err := cur.Decode(&manifest); err != nil {
+			return deletedManifests, 0, err
+		}
+		for _, ref := range manifest.Chunks {
+			referencedChunks[ref.ChunkID] = true
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return deletedManifests, 0, err
+	}
+
+	deletedChunks, err := sweepCollection(ctx, "manifest_chunks", oldFilter, referencedChunks)
+	return deletedManifests, deletedChunks, err
+}
+
+// Delete the documents of a collection that match the filter and whose IDs aren't referenced.
+func sweepCollection(ctx context.Context, collection string, filter bson.M, referenced map[string]bool) (int64, error) {
+	cur, err := config.MI.DB.Collection(collection).Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+
+	var deleted int64
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		// Documents written since they were found are kept
+		res, err := config.MI.DB.Collection(collection).DeleteMany(ctx, bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$in": batch}}}})
+		if err != nil {
+			return err
+		}
+		deleted += res.DeletedCount
+		batch = batch[:0]
+		return nil
+	}
+
+	for cur.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			return deleted, err
+		}
+		if referenced[doc.ID] {
+			continue
+		}
+
+		batch = append(batch, doc.ID)
+		if len(batch) == sweepBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return deleted, err
+	}
+
+	return deleted, flush()
+}
@@ -0,0 +1,87 @@
+package manifest_lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/decentvcs/server/models"
+)
+
+func TestNewChunks(t *testing.T) {
+	files := make(map[string]models.FileData)
+	for i := 0; i < 5000; i++ {
+		files[fmt.Sprintf("Content/file%05d.uasset", i)] = models.FileData{Hash: fmt.Sprintf("%064d", i)}
+	}
+
+	chunks, err := newChunks(files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want large directory split into several", len(chunks))
+	}
+
+	// Every entry is in exactly one chunk, in path order
+	var last string
+	count := 0
+	for _, chunk := range chunks {
+		for _, entry := range chunk.Entries {
+			if entry.Path <= last {
+				t.Fatalf("entry %s out of order after %s", entry.Path, last)
+			}
+			last = entry.Path
+			count++
+		}
+	}
+	if count != len(files) {
+		t.Fatalf("got %d entries, want %d", count, len(files))
+	}
+
+	// Adding a file only changes the chunk it falls into
+	files["Content/file02500a.uasset"] = models.FileData{Hash: "new"}
+	changed, err := newChunks(files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ids := make(map[string]bool)
+	for _, chunk := range chunks {
+		ids[chunk.ID] = true
+	}
+	newIDs := 0
+	for _, chunk := range changed {
+		if !ids[chunk.ID] {
+			newIDs++
+		}
+	}
+	if newIDs != 1 {
+		t.Errorf("got %d new chunks after adding a file, want 1", newIDs)
+	}
+}
+
+func TestNewChunksMaxSize(t *testing.T) {
+	// Entries with long patch histories, about 150 KB each
+	patchHashes := make([]string, 2000)
+	for i := range patchHashes {
+		patchHashes[i] = strings.Repeat("a", 64)
+	}
+
+	files := make(map[string]models.FileData)
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("Maps/level%d.umap", i)] = models.FileData{Hash: "hash", PatchHashes: patchHashes}
+	}
+
+	chunks, err := newChunks(files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, chunk := range chunks {
+		size := 0
+		for _, entry := range chunk.Entries {
+			size += entrySize(entry)
+		}
+		if size > maxChunkSize {
+			t.Errorf("got chunk of %d bytes, want at most %d", size, maxChunkSize)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Create indexes for the "branch_comparisons" cache.
+// Cached comparisons expire after 30 days so that comparisons of old heads don't pile up.
+func createBranchComparisonIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("branch_comparisons").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "head_commit_id", Value: 1}, {Key: "base_commit_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60),
+		},
+	})
+	return err
+}
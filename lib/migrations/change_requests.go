@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Create indexes for listing change requests and their reviews and comments. Only one change request can be open for
+// the same pair of branches.
+func createChangeRequestIndexes(ctx context.Context) error {
+	if _, err := config.MI.DB.Collection("change_requests").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "source_branch_id", Value: 1}, {Key: "target_branch_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.ChangeRequestStatusOpen}),
+		},
+	}); err != nil {
+		return err
+	}
+
+	for _, collection := range []string{"change_request_reviews", "change_request_comments"} {
+		if _, err := config.MI.DB.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "change_request_id", Value: 1}, {Key: "created_at", Value: 1}},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Set `parent_ids` on commits created before parents were recorded.
+//
+// Must run before commits are renumbered, since parents are inferred from the per-branch index order.
+func backfillCommitParents(ctx context.Context) error {
+	cur, err := config.MI.DB.Collection("branches").Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+
+	var branches []models.Branch
+	if err := cur.All(ctx, &branches); err != nil {
+		return err
+	}
+
+	for _, branch := range branches {
+		cur, err := config.MI.DB.Collection("commits").Find(
+			ctx,
+			bson.M{"branch_id": branch.ID},
+			options.Find().
+				SetSort(bson.D{{Key: "index", Value: 1}, {Key: "created_at", Value: 1}}).
+				SetProjection(bson.M{"_id": 1, "index": 1, "project_id": 1, "parent_ids": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		var commits []models.Commit
+		if err := cur.All(ctx, &commits); err != nil {
+			return err
+		}
+
+		var writes []mongo.WriteModel
+		for i, commit := range commits {
+			if len(commit.ParentIDs) > 0 {
+				continue
+			}
+
+			var parentID primitive.ObjectID
+			if i > 0 {
+				// Previous commit in the branch
+				parentID = commits[i-1].ID
+			} else if commit.Index > 1 {
+				// First commit in a branch that was created from another branch's commit.
+				// Only use it if the index is unambiguous.
+				var candidates []models.Commit
+				cur, err := config.MI.DB.Collection("commits").Find(
+					ctx,
+					bson.M{"project_id": commit.ProjectID, "index": commit.Index - 1},
+					options.Find().SetLimit(2).SetProjection(bson.M{"_id": 1}),
+				)
+				if err != nil {
+					return err
+				}
+				if err := cur.All(ctx, &candidates); err != nil {
+					return err
+				}
+				if len(candidates) == 1 {
+					parentID = candidates[0].ID
+				}
+			}
+
+			if parentID.IsZero() {
+				continue
+			}
+
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": commit.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"parent_ids": []primitive.ObjectID{parentID}}}))
+		}
+
+		if len(writes) > 0 {
+			if _, err := config.MI.DB.Collection("commits").BulkWrite(ctx, writes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Make commit indexes unique within each project and initialize the per-project commit counters.
+//
+// Branches forked from the same commit used to mint the same indexes. The oldest commit keeps its index, and every
+// duplicate is renumbered after the highest index in the project, keeping its old number in `legacy_index`.
+func renumberCommitIndexes(ctx context.Context) error {
+	projectIDs, err := config.MI.DB.Collection("commits").Distinct(ctx, "project_id", bson.M{})
+	if err != nil {
+		return err
+	}
+
+	for _, projectID := range projectIDs {
+		cur, err := config.MI.DB.Collection("commits").Find(
+			ctx,
+			bson.M{"project_id": projectID},
+			options.Find().
+				SetSort(bson.D{{Key: "index", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+				SetProjection(bson.M{"_id": 1, "index": 1}),
+		)
+		if err != nil {
+			return err
+		}
+
+		var commits []models.Commit
+		if err := cur.All(ctx, &commits); err != nil {
+			return err
+		}
+
+		maxIndex := 0
+		for _, commit := range commits {
+			if commit.Index > maxIndex {
+				maxIndex = commit.Index
+			}
+		}
+
+		seen := make(map[int]bool)
+		var writes []mongo.WriteModel
+		for _, commit := range commits {
+			if !seen[commit.Index] {
+				seen[commit.Index] = true
+				continue
+			}
+
+			maxIndex++
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": commit.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"index": maxIndex, "legacy_index": commit.Index}}))
+		}
+
+		if len(writes) > 0 {
+			if _, err := config.MI.DB.Collection("commits").BulkWrite(ctx, writes); err != nil {
+				return err
+			}
+		}
+
+		// Continue numbering after the highest index
+		if _, err := config.MI.DB.Collection("counters").UpdateOne(
+			ctx,
+			bson.M{"_id": projectID},
+			bson.M{"$max": bson.M{"seq": maxIndex}},
+			options.Update().SetUpsert(true),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Create indexes for the "commits" collection.
+func createCommitIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("commits").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "project_id", Value: 1}, {Key: "index", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "project_id", Value: 1}, {Key: "legacy_index", Value: 1}},
+			Options: options.Index().SetPartialFilterExpression(bson.M{"legacy_index": bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: "branch_id", Value: 1}, {Key: "index", Value: 1}},
+		},
+	})
+	return err
+}
+
+// Create indexes used by commit search.
+func createCommitSearchIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("commits").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "message", Value: "text"}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "author_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "created_files", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "modified_files", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "deleted_files", Value: 1}},
+		},
+	})
+	return err
+}
+
+// Create indexes used by cursor-based commit pagination within a branch.
+func createCommitPaginationIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("commits").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "branch_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	})
+	return err
+}
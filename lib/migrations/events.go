@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Create indexes for the "events" collection. Events are deleted once they're older than the retention period.
+func createEventIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("events").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(events.Retention.Seconds())),
+		},
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Move the locks embedded in branch documents to the "locks" collection, and create its indexes.
+// The time locks were created at wasn't recorded, so migrated locks are dated to the migration.
+func moveBranchLocksToCollection(ctx context.Context) error {
+	if _, err := config.MI.DB.Collection("locks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "branch_id", Value: 1}, {Key: "path", Value: 1}}},
+		{Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "path", Value: 1}}},
+		{Keys: bson.D{{Key: "project_id", Value: 1}, {Key: "user_id", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+
+	cur, err := config.MI.DB.Collection("branches").Find(ctx, bson.M{"locks": bson.M{"$type": "object"}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	now := time.Now()
+	for cur.Next(ctx) {
+		var branch models.Branch
+		if err := cur.Decode(&branch); err != nil {
+			return err
+		}
+
+		var locks []interface{}
+		for path, userID := range branch.Locks {
+			locks = append(locks, models.Lock{
+				ID:        primitive.NewObjectID(),
+				CreatedAt: now,
+				ProjectID: branch.ProjectID,
+				BranchID:  branch.ID,
+				Path:      path,
+				UserID:    userID,
+			})
+		}
+
+		if len(locks) > 0 {
+			// Drop locks left by an earlier, interrupted run of this migration
+			if _, err := config.MI.DB.Collection("locks").DeleteMany(ctx, bson.M{"branch_id": branch.ID}); err != nil {
+				return err
+			}
+			if _, err := config.MI.DB.Collection("locks").InsertMany(ctx, locks); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	_, err = config.MI.DB.Collection("branches").UpdateMany(ctx, bson.M{"locks": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"locks": ""}})
+	return err
+}
+
+// Make locks unique per branch and path, so concurrent lock requests can't both acquire the same path. If a path was
+// locked more than once, only its newest active lock is kept, since older ones are usually stale.
+func createUniqueLockIndex(ctx context.Context) error {
+	cur, err := config.MI.DB.Collection("locks").Aggregate(ctx, []bson.M{
+		{"$sort": bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{"$group": bson.M{
+			"_id":   bson.M{"branch_id": "$branch_id", "path": "$path"},
+			"locks": bson.M{"$push": bson.M{"_id": "$_id", "expires_at": "$expires_at"}},
+			"count": bson.M{"$sum": 1},
+		}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		Locks []models.Lock `bson:"locks"`
+	}
+	if err := cur.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, duplicate := range duplicates {
+		// Locks are sorted newest first; keep the first one that hasn't expired, if any
+		kept := false
+		var removedIDs []primitive.ObjectID
+		for _, lock := range duplicate.Locks {
+			expired := lock.ExpiresAt != nil && !lock.ExpiresAt.After(now)
+			if !kept && !expired {
+				kept = true
+				continue
+			}
+
+			removedIDs = append(removedIDs, lock.ID)
+		}
+
+		if _, err := config.MI.DB.Collection("locks").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": removedIDs}}); err != nil {
+			return err
+		}
+	}
+
+	// Replace the non-unique index created by "move_branch_locks_to_collection"
+	if _, err := config.MI.DB.Collection("locks").Indexes().DropOne(ctx, "branch_id_1_path_1"); err != nil {
+		// Already dropped by an earlier, interrupted run of this migration
+		var cmdErr mongo.CommandError
+		if !errors.As(err, &cmdErr) || cmdErr.Name != "IndexNotFound" {
+			return err
+		}
+	}
+
+	_, err = config.MI.DB.Collection("locks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "branch_id", Value: 1}, {Key: "path", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// Create indexes for listing unlock requests and cancelling the pending requests of a lock. Users can only have one
+// pending request per lock.
+func createUnlockRequestIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("unlock_requests").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "branch_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "lock_id", Value: 1}, {Key: "status", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "lock_id", Value: 1}, {Key: "requester_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": models.UnlockRequestStatusPending}),
+		},
+	})
+	return err
+}
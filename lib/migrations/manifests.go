@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/manifest_lib"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Move the full `files` map embedded in each commit into a separate manifest, keeping only the entries of created
+// and modified files on the commit.
+func moveCommitFilesToManifests(ctx context.Context) error {
+	cur, err := config.MI.DB.Collection("commits").Find(
+		ctx,
+		bson.M{"files": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"_id": 1, "files": 1, "created_files": 1, "modified_files": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var commit models.Commit
+		if err := cur.Decode(&commit); err != nil {
+			return err
+		}
+
+		manifestID, err := manifest_lib.Store(ctx, commit.Files)
+		if err != nil {
+			return err
+		}
+
+		changedFiles := make(map[string]models.FileData)
+		for _, path := range append(commit.CreatedFiles, commit.ModifiedFiles...) {
+			if data, ok := commit.Files[path]; ok {
+				changedFiles[path] = data
+			}
+		}
+
+		if _, err := config.MI.DB.Collection("commits").UpdateByID(ctx, commit.ID, bson.M{
+			"$set":   bson.M{"manifest_id": manifestID, "changed_files": changedFiles},
+			"$unset": bson.M{"files": ""},
+		}); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
@@ -0,0 +1,143 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type migration struct {
+	// Unique name of the migration. Must never change once released.
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Ordered list of all migrations.
+// New migrations must be appended to the end.
+var migrations = []migration{
+	{name: "backfill_commit_parents", run: backfillCommitParents},
+	{name: "renumber_commit_indexes", run: renumberCommitIndexes},
+	{name: "create_commit_indexes", run: createCommitIndexes},
+	{name: "create_tag_indexes", run: createTagIndexes},
+	{name: "create_commit_search_indexes", run: createCommitSearchIndexes},
+	{name: "create_signing_key_indexes", run: createSigningKeyIndexes},
+	{name: "move_commit_files_to_manifests", run: moveCommitFilesToManifests},
+	{name: "create_reflog_indexes", run: createReflogIndexes},
+	{name: "create_commit_pagination_indexes", run: createCommitPaginationIndexes},
+	{name: "create_change_request_indexes", run: createChangeRequestIndexes},
+	{name: "create_branch_comparison_indexes", run: createBranchComparisonIndexes},
+	{name: "move_branch_locks_to_collection", run: moveBranchLocksToCollection},
+	{name: "create_unique_lock_index", run: createUniqueLockIndex},
+	{name: "create_unlock_request_indexes", run: createUnlockRequestIndexes},
+	{name: "create_event_indexes", run: createEventIndexes},
+}
+
+// Max time a migration may run for. Also the duration of the claim on a running migration.
+const migrationTimeout = 10 * time.Minute
+
+// Run all migrations that haven't been applied yet.
+// NOTE: This should only ever be called once (at the start of the app), after the database is initialized.
+//
+// A migration is only recorded as applied once it succeeds. While it runs, the instance running it holds a lease on
+// it, so that other server instances starting at the same time wait for it instead of running it again. If the
+// instance dies mid-migration, the lease expires and the migration is run again, so migrations must be safe to re-run
+// after being partially applied.
+func Run() {
+	for _, m := range migrations {
+		for {
+			applied, claimed, err := claim(m.name)
+			if err != nil {
+				log.Fatalf("[migrations] Error claiming migration \"%s\": %v", m.name, err)
+			}
+			if applied {
+				break
+			}
+			if !claimed {
+				// Another instance is running the migration; later migrations may depend on it, so wait
+				fmt.Printf("[migrations] Waiting for \"%s\" to be applied by another instance\n", m.name)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+
+			fmt.Printf("[migrations] Running \"%s\"\n", m.name)
+			ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+			err = m.run(ctx)
+			cancel()
+
+			// The migration's context may have expired, so use a fresh one to record the outcome
+			if err != nil {
+				// Release claim so the migration is retried on next start
+				releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 10*time.Second)
+				config.MI.DB.Collection("migrations").DeleteOne(releaseCtx, bson.M{"_id": m.name, "applied_at": bson.M{"$exists": false}})
+				releaseCancel()
+				log.Fatalf("[migrations] Migration \"%s\" failed: %v", m.name, err)
+			}
+
+			if err := markApplied(m.name); err != nil {
+				log.Fatalf("[migrations] Error recording migration \"%s\": %v", m.name, err)
+			}
+			break
+		}
+	}
+}
+
+// Try to claim a migration for this instance.
+//
+// Returns `applied` if the migration was already applied, and `claimed` if this instance should run it.
+func claim(name string) (applied bool, claimed bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Matches the record only if it isn't applied and its lease has expired. If there's no record, one is inserted.
+	now := time.Now()
+	_, err = config.MI.DB.Collection("migrations").UpdateOne(
+		ctx,
+		bson.M{
+			"_id":              name,
+			"applied_at":       bson.M{"$exists": false},
+			"lease_expires_at": bson.M{"$lte": now},
+		},
+		bson.M{"$set": bson.M{"lease_expires_at": now.Add(migrationTimeout)}},
+		options.Update().SetUpsert(true),
+	)
+	if err == nil {
+		return false, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, false, err
+	}
+
+	// The record exists but didn't match, so it's either applied or claimed by another instance
+	var record models.Migration
+	if err := config.MI.DB.Collection("migrations").FindOne(ctx, bson.M{"_id": name}).Decode(&record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Claim was released in the meantime
+			return false, false, nil
+		}
+
+		return false, false, err
+	}
+
+	return record.AppliedAt != nil, false, nil
+}
+
+// Record a migration as applied.
+func markApplied(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := config.MI.DB.Collection("migrations").UpdateOne(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"applied_at": time.Now()}, "$unset": bson.M{"lease_expires_at": ""}},
+	)
+	return err
+}
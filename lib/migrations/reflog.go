@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Create indexes for the "reflog" collection and for finding soft-deleted commits.
+func createReflogIndexes(ctx context.Context) error {
+	if _, err := config.MI.DB.Collection("reflog").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "branch_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	}); err != nil {
+		return err
+	}
+
+	_, err := config.MI.DB.Collection("commits").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "deleted_at", Value: 1}},
+	})
+	return err
+}
@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/decentvcs/server/config"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Create indexes for the "signing_keys" collection.
+func createSigningKeyIndexes(ctx context.Context) error {
+	_, err := config.MI.DB.Collection("signing_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "public_key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
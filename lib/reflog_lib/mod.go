@@ -0,0 +1,53 @@
+package reflog_lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Record a movement of a branch's head.
+func Record(ctx context.Context, entry *models.ReflogEntry) error {
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = time.Now()
+
+	_, err := config.MI.DB.Collection("reflog").InsertOne(ctx, entry)
+	return err
+}
+
+// Get the latest reflog entry of a branch recorded at or before the given time.
+//
+// Returns `mongo.ErrNoDocuments` if there is none.
+func GetLatestAt(ctx context.Context, branchID primitive.ObjectID, t time.Time) (*models.ReflogEntry, error) {
+	var entry models.ReflogEntry
+	if err := config.MI.DB.Collection("reflog").FindOne(
+		ctx,
+		bson.M{"branch_id": branchID, "created_at": bson.M{"$lte": t}},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}),
+	).Decode(&entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Get the oldest reflog entry of a branch.
+//
+// Returns `mongo.ErrNoDocuments` if the branch has no entries.
+func GetOldest(ctx context.Context, branchID primitive.ObjectID) (*models.ReflogEntry, error) {
+	var entry models.ReflogEntry
+	if err := config.MI.DB.Collection("reflog").FindOne(
+		ctx,
+		bson.M{"branch_id": branchID},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+	).Decode(&entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
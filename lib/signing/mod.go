@@ -0,0 +1,98 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/decentvcs/server/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidPublicKey = errors.New("public key must be a base64-encoded ed25519 public key")
+
+// Canonical form of a commit that clients sign.
+//
+// Covers the full change set of the commit, so that together with the parent it determines the commit's resulting
+// manifest. Serialized as compact JSON with fields in this order, `files` keys and `deleted_files` sorted
+// lexicographically, no HTML escaping (`<`, `>` and `&` are written as is) and no trailing newline, e.g.:
+//
+//	{"parent_ids":["<hex>"],"files":{"a.txt":{"hash":"...","patch_hashes":[],"version":1}},"deleted_files":["b.txt"],"message":"..."}
+type canonicalCommit struct {
+	ParentIDs    []string                   `json:"parent_ids"`
+	Files        map[string]models.FileData `json:"files"`
+	DeletedFiles []string                   `json:"deleted_files"`
+	Message      string                     `json:"message"`
+}
+
+// Returns the canonical serialization of a commit, which is the payload that gets signed.
+//
+// `files` must only contain the data of created and modified files, and `deletedFiles` the paths of deleted files.
+func CanonicalCommitPayload(
+	parentIDs []primitive.ObjectID,
+	files map[string]models.FileData,
+	deletedFiles []string,
+	message string,
+) ([]byte, error) {
+	parentIDHexes := make([]string, len(parentIDs))
+	for i, id := range parentIDs {
+		parentIDHexes[i] = id.Hex()
+	}
+
+	// Always serialize patch hashes as an array, regardless of whether the client omitted them
+	normalizedFiles := make(map[string]models.FileData, len(files))
+	for path, data := range files {
+		if data.PatchHashes == nil {
+			data.PatchHashes = []string{}
+		}
+		normalizedFiles[path] = data
+	}
+
+	sortedDeletedFiles := append([]string{}, deletedFiles...)
+	sort.Strings(sortedDeletedFiles)
+
+	// encoding/json sorts map keys, so the output is deterministic. HTML escaping is disabled so that clients using
+	// other JSON encoders produce the same bytes.
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(canonicalCommit{
+		ParentIDs:    parentIDHexes,
+		Files:        normalizedFiles,
+		DeletedFiles: sortedDeletedFiles,
+		Message:      message,
+	}); err != nil {
+		return nil, err
+	}
+
+	// Encode always appends a newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Decode and validate a base64-encoded ed25519 public key.
+func ParsePublicKey(publicKeyB64 string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKeyB64)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// Returns true if `signatureB64` is a valid base64-encoded signature of `payload` by the given public key.
+func Verify(publicKeyB64 string, payload []byte, signatureB64 string) bool {
+	key, err := ParsePublicKey(publicKeyB64)
+	if err != nil {
+		return false
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(key, payload, signature)
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/decentvcs/server/config"
 	"github.com/decentvcs/server/constants"
+	"github.com/decentvcs/server/lib/jobs"
+	"github.com/decentvcs/server/lib/migrations"
 	"github.com/decentvcs/server/routes"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -26,9 +28,11 @@ func main() {
 	// Initialize stuff
 	config.InitConfig()
 	config.InitDatabase()
+	migrations.Run()
 	config.InitStorage()
 	config.InitStytch()
 	config.InitValidator()
+	jobs.Start()
 
 	// Create Fiber instance
 	app := fiber.New(fiber.Config{
@@ -37,8 +41,9 @@ func main() {
 
 	// Configure global middleware
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: fmt.Sprintf("Origin, Content-Type, Accept, %s", constants.SessionTokenHeader),
+		AllowOrigins:  "*",
+		AllowHeaders:  fmt.Sprintf("Origin, Content-Type, Accept, %s", constants.SessionTokenHeader),
+		ExposeHeaders: "X-Next-Cursor, X-Prev-Cursor, X-Total-Count",
 	}))
 
 	if config.I.Debug {
@@ -59,6 +64,9 @@ func main() {
 	routes.RouteProjects(projectGroup)
 	routes.RouteBranches(projectGroup.Group("/branches"))
 	routes.RouteCommits(projectGroup.Group("/commits"))
+	routes.RouteTags(projectGroup.Group("/tags"))
+	routes.RouteChangeRequests(projectGroup.Group("/change_requests"))
+	routes.RouteProjectLocks(projectGroup.Group("/locks"))
 	routes.RouteStorage(projectGroup.Group("/storage"))
 
 	// Start server
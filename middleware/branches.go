@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/decentvcs/server/config"
+	"github.com/decentvcs/server/lib/auth"
+	"github.com/decentvcs/server/lib/branch_lib"
+	"github.com/decentvcs/server/lib/team_lib"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Fiber middleware that ensures the user can access the requested branch.
+// Private branches are reported as not found to everyone but their owner and team admins. Missing projects and
+// branches are left for the handler to report.
+//
+// Assumes that `HasTeamAccess` was included as middleware BEFORE this one.
+func HasBranchAccess(c *fiber.Ctx) error {
+	userData := auth.GetUserDataFromContext(c)
+	team := team_lib.GetTeamFromContext(c)
+	projectName := c.Params("project_name")
+	branchName := c.Params("branch_name")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project models.Project
+	if err := config.MI.DB.Collection("projects").FindOne(ctx, bson.M{"team_id": team.ID, "name": projectName}).Decode(&project); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Next()
+		}
+
+		fmt.Printf("[middleware.HasBranchAccess] Error getting project: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	var branch models.Branch
+	if err := config.MI.DB.Collection("branches").FindOne(ctx, bson.M{
+		"project_id": project.ID,
+		"name":       branchName,
+		"deleted_at": bson.M{"$exists": false},
+	}).Decode(&branch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Next()
+		}
+
+		fmt.Printf("[middleware.HasBranchAccess] Error getting branch: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if !branch_lib.CanAccess(branch.Visibility, branch.OwnerID, userData, team.ID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Branch not found",
+		})
+	}
+
+	return c.Next()
+}
@@ -6,16 +6,28 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+type BranchVisibility string
+
+const (
+	// Visible to the whole team. Branches without a visibility are visible to the team.
+	BranchVisibilityTeam BranchVisibility = "team"
+	// Only visible to the branch's owner and team admins.
+	BranchVisibilityPrivate BranchVisibility = "private"
+)
+
 type Branch struct {
 	ID        primitive.ObjectID `json:"_id" bson:"_id"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	DeletedAt time.Time          `json:"deleted_at" bson:"deleted_at"`
 	Name      string             `json:"name" bson:"name" validate:"required"`
 	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id" validate:"required"`
+	// ID of the user who created the branch.
+	OwnerID    string           `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	Visibility BranchVisibility `json:"visibility,omitempty" bson:"visibility,omitempty"`
 	// ID of the commit that this branch currently points to (a.k.a. the latest commit).
 	CommitID primitive.ObjectID `json:"commit_id" bson:"commit_id" validate:"required"`
 	// Map of file path to user ID.
-	// Denotes which file paths are currently locked for this branch, and by whom.
+	// Denotes which file paths are currently locked for this branch, and by whom. Joined from the "locks" collection.
 	Locks map[string]string `json:"locks" bson:"locks"`
 }
 
@@ -25,17 +37,47 @@ type BranchWithCommit struct {
 	DeletedAt time.Time          `json:"deleted_at" bson:"deleted_at"`
 	Name      string             `json:"name" bson:"name"`
 	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	// ID of the user who created the branch.
+	OwnerID    string           `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	Visibility BranchVisibility `json:"visibility,omitempty" bson:"visibility,omitempty"`
+	// ID of the commit that this branch currently points to. Only set if the commit isn't joined.
+	CommitID primitive.ObjectID `json:"commit_id,omitempty" bson:"commit_id,omitempty"`
 	// The commit that this branch currently points to (a.k.a. the latest commit).
 	Commit Commit `json:"commit" bson:"commit"`
 	// Map of file path to user ID.
-	// Denotes which file paths are currently locked for this branch, and by whom.
+	// Denotes which file paths are currently locked for this branch, and by whom. Joined from the "locks" collection.
 	Locks map[string]string `json:"locks" bson:"locks"`
+	// Comparison with a base branch, if requested.
+	Comparison *BranchComparison `json:"comparison,omitempty" bson:"-"`
+}
+
+// [Database model]
+//
+// Comparison of a branch's head with the head of a base branch. Commits never change, so comparisons are cached per
+// pair of heads.
+type BranchComparison struct {
+	ID           primitive.ObjectID `json:"-" bson:"_id"`
+	CreatedAt    time.Time          `json:"-" bson:"created_at"`
+	HeadCommitID primitive.ObjectID `json:"head_commit_id" bson:"head_commit_id"`
+	BaseCommitID primitive.ObjectID `json:"base_commit_id" bson:"base_commit_id"`
+	// ID of the newest commit in both histories. Empty if the histories don't meet.
+	MergeBaseID primitive.ObjectID `json:"merge_base_id,omitempty" bson:"merge_base_id,omitempty"`
+	// Number of commits only in the branch's history.
+	Ahead int `json:"ahead" bson:"ahead"`
+	// Number of commits only in the base branch's history.
+	Behind int `json:"behind" bson:"behind"`
+	// Number of paths the branch changed since the merge base.
+	ChangedPaths int `json:"changed_paths" bson:"changed_paths"`
 }
 
 type BranchCreateDTO struct {
 	Name        string `json:"name,omitempty"`
 	ProjectID   string `json:"project_id,omitempty"`
 	CommitIndex int    `json:"commit_index,omitempty"`
+	// Name of a tag to create the branch from. Used instead of `commit_index` if set.
+	Tag string `json:"tag,omitempty"`
+	// Either "team" (default) or "private".
+	Visibility BranchVisibility `json:"visibility,omitempty" validate:"omitempty,oneof=team private"`
 }
 
 type BranchCreateBSON struct {
@@ -43,11 +85,11 @@ type BranchCreateBSON struct {
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	Name      string             `json:"name" bson:"name"`
 	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	// ID of the user who created the branch.
+	OwnerID    string           `json:"owner_id,omitempty" bson:"owner_id,omitempty"`
+	Visibility BranchVisibility `json:"visibility,omitempty" bson:"visibility,omitempty"`
 	// The commit that this branch currently points to (a.k.a. the latest commit).
 	CommitID primitive.ObjectID `json:"commit_id" bson:"commit_id"`
-	// Map of file path to user ID.
-	// Denotes which file paths are currently locked for this branch, and by whom.
-	Locks map[string]string `json:"locks" bson:"locks"`
 }
 
 type BranchUpdateDTO struct {
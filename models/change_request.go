@@ -0,0 +1,111 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ChangeRequestStatus string
+
+const (
+	ChangeRequestStatusOpen   ChangeRequestStatus = "open"
+	ChangeRequestStatusMerged ChangeRequestStatus = "merged"
+	ChangeRequestStatusClosed ChangeRequestStatus = "closed"
+)
+
+type ReviewState string
+
+const (
+	ReviewStateApproved         ReviewState = "approved"
+	ReviewStateChangesRequested ReviewState = "changes_requested"
+)
+
+// [Database model]
+//
+// Proposal to merge the changes of a source branch into a target branch.
+type ChangeRequest struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	Title     string             `json:"title" bson:"title"`
+	// Optional longer description of the changes.
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	// ID of the user who opened the change request.
+	AuthorID       string              `json:"author_id" bson:"author_id"`
+	SourceBranchID primitive.ObjectID  `json:"source_branch_id" bson:"source_branch_id"`
+	TargetBranchID primitive.ObjectID  `json:"target_branch_id" bson:"target_branch_id"`
+	Status         ChangeRequestStatus `json:"status" bson:"status"`
+	// Time the change request was merged or closed.
+	ClosedAt *time.Time `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+	// ID of the user who merged or closed the change request.
+	ClosedBy string `json:"closed_by,omitempty" bson:"closed_by,omitempty"`
+	// ID of the commit created by merging the change request.
+	MergeCommitID primitive.ObjectID `json:"merge_commit_id,omitempty" bson:"merge_commit_id,omitempty"`
+}
+
+// [Database model]
+//
+// Review of a change request. Reviews apply to the source branch's head at the time of the review, so approvals
+// become stale when new commits are pushed to the source branch.
+type ChangeRequestReview struct {
+	ID              primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	ChangeRequestID primitive.ObjectID `json:"change_request_id" bson:"change_request_id"`
+	ReviewerID      string             `json:"reviewer_id" bson:"reviewer_id"`
+	State           ReviewState        `json:"state" bson:"state"`
+	// ID of the source branch's head commit that was reviewed.
+	CommitID primitive.ObjectID `json:"commit_id" bson:"commit_id"`
+	Body     string             `json:"body,omitempty" bson:"body,omitempty"`
+}
+
+// [Database model]
+//
+// Comment on a change request.
+type ChangeRequestComment struct {
+	ID              primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+	ChangeRequestID primitive.ObjectID `json:"change_request_id" bson:"change_request_id"`
+	AuthorID        string             `json:"author_id" bson:"author_id"`
+	Body            string             `json:"body" bson:"body"`
+	// Optional path of the file the comment is about.
+	Path string `json:"path,omitempty" bson:"path,omitempty"`
+	// ID of the comment this comment replies to, if it's part of a thread.
+	ParentID primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+}
+
+// Changes of a change request's source branch since it diverged from the target branch.
+type ChangeRequestDiff struct {
+	// Nearest common ancestor of the source and target branch heads.
+	MergeBase *Commit             `json:"merge_base"`
+	Source    *Commit             `json:"source"`
+	Target    *Commit             `json:"target"`
+	Created   map[string]FileData `json:"created"`
+	Modified  map[string]FileData `json:"modified"`
+	Deleted   []string            `json:"deleted"`
+	// Paths changed differently in both branches since the merge base.
+	Conflicts []string `json:"conflicts"`
+}
+
+// Request body for `CreateChangeRequest`.
+type CreateChangeRequestRequest struct {
+	Title        string `json:"title" validate:"required,max=256"`
+	Description  string `json:"description,omitempty"`
+	SourceBranch string `json:"source_branch" validate:"required"`
+	TargetBranch string `json:"target_branch" validate:"required,nefield=SourceBranch"`
+}
+
+// Request body for `CreateChangeRequestReview`.
+type CreateChangeRequestReviewRequest struct {
+	State ReviewState `json:"state" validate:"required,oneof=approved changes_requested"`
+	// ID of the source branch's head commit that was reviewed. Rejected if the branch has moved since.
+	CommitID string `json:"commit_id" validate:"required"`
+	Body     string `json:"body,omitempty"`
+}
+
+// Request body for `CreateChangeRequestComment`.
+type CreateChangeRequestCommentRequest struct {
+	Body     string `json:"body" validate:"required"`
+	Path     string `json:"path,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
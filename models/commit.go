@@ -9,54 +9,147 @@ import (
 type Commit struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
-	Index     int                `json:"index,omitempty" bson:"index,omitempty"`
-	ProjectID primitive.ObjectID `json:"project_id,omitempty" bson:"project_id,omitempty"`
-	BranchID  primitive.ObjectID `json:"branch_id,omitempty" bson:"branch_id,omitempty"`
-	Message   string             `json:"message,omitempty" bson:"message,omitempty"`
+	// Commit number, unique in the scope of the project.
+	Index int `json:"index,omitempty" bson:"index,omitempty"`
+	// Index the commit had before it was renumbered to be unique within the project (if it was).
+	LegacyIndex int                `json:"legacy_index,omitempty" bson:"legacy_index,omitempty"`
+	ProjectID   primitive.ObjectID `json:"project_id,omitempty" bson:"project_id,omitempty"`
+	BranchID    primitive.ObjectID `json:"branch_id,omitempty" bson:"branch_id,omitempty"`
+	// IDs of the parent commits. Empty for the initial commit of a project.
+	ParentIDs []primitive.ObjectID `json:"parent_ids,omitempty" bson:"parent_ids,omitempty"`
+	Message   string               `json:"message,omitempty" bson:"message,omitempty"`
 	// Array of relative fs paths to created files
 	CreatedFiles []string `json:"created_files,omitempty" bson:"created_files,omitempty"`
 	// Array of relative fs paths to modified files
 	ModifiedFiles []string `json:"modified_files,omitempty" bson:"modified_files,omitempty"`
 	// Array of relative fs paths to deleted files
 	DeletedFiles []string `json:"deleted_files,omitempty" bson:"deleted_files,omitempty"`
-	// Map of relative fs paths to their associated data
+	// ID of the manifest describing the full file state of the commit.
+	ManifestID string `json:"manifest_id,omitempty" bson:"manifest_id,omitempty"`
+	// Map of relative fs paths to their associated data, for created and modified files only
+	ChangedFiles map[string]FileData `json:"changed_files,omitempty" bson:"changed_files,omitempty"`
+	// Map of all relative fs paths to their associated data.
+	// Not stored with the commit; only set when materialized from the manifest on request.
 	Files map[string]FileData `json:"files,omitempty" bson:"files,omitempty"`
 	// ID of the user who made the commit.
 	// If empty, then the system created it.
 	AuthorID string `json:"author_id,omitempty" bson:"author_id,omitempty"`
+	// IDs of the commits that this commit reverts, if it was created by a revert.
+	RevertedCommitIDs []primitive.ObjectID `json:"reverted_commit_ids,omitempty" bson:"reverted_commit_ids,omitempty"`
+	// ID of the commit that this commit was cherry-picked from, if any.
+	CherryPickedFromID primitive.ObjectID `json:"cherry_picked_from_id,omitempty" bson:"cherry_picked_from_id,omitempty"`
+	// Base64-encoded ed25519 signature of the commit's canonical serialization, if it was signed.
+	Signature string `json:"signature,omitempty" bson:"signature,omitempty"`
+	// ID of the signing key that produced `signature`.
+	SigningKeyID primitive.ObjectID `json:"signing_key_id,omitempty" bson:"signing_key_id,omitempty"`
+	// If `true`, the signature was verified against one of the author's signing keys when the commit was created.
+	Verified bool `json:"verified" bson:"verified"`
+	// Set when the commit was removed from its branch's history (e.g. by a squash). Such commits are kept for
+	// recovery but hidden from commit listings.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
 }
 type CommitWithBranch struct {
 	ID        primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	Index     int                `json:"index,omitempty" bson:"index,omitempty"`
 	ProjectID primitive.ObjectID `json:"project_id,omitempty" bson:"project_id,omitempty"`
-	Branch    Branch             `json:"branch,omitempty" bson:"branch,omitempty"`
-	Message   string             `json:"message,omitempty" bson:"message,omitempty"`
+	// Branch the commit was made in, if it still exists.
+	Branch *Branch `json:"branch,omitempty" bson:"branch,omitempty"`
+	// IDs of the parent commits. Empty for the initial commit of a project.
+	ParentIDs []primitive.ObjectID `json:"parent_ids,omitempty" bson:"parent_ids,omitempty"`
+	Message   string               `json:"message,omitempty" bson:"message,omitempty"`
 	// Array of relative fs paths to created files
 	CreatedFiles []string `json:"created_files,omitempty" bson:"created_files,omitempty"`
 	// Array of relative fs paths to modified files
 	ModifiedFiles []string `json:"modified_files,omitempty" bson:"modified_files,omitempty"`
 	// Array of relative fs paths to deleted files
 	DeletedFiles []string `json:"deleted_files,omitempty" bson:"deleted_files,omitempty"`
-	// Map of relative fs paths to their associated data
+	// ID of the manifest describing the full file state of the commit.
+	ManifestID string `json:"manifest_id,omitempty" bson:"manifest_id,omitempty"`
+	// Map of relative fs paths to their associated data, for created and modified files only
+	ChangedFiles map[string]FileData `json:"changed_files,omitempty" bson:"changed_files,omitempty"`
+	// Map of all relative fs paths to their associated data.
+	// Not stored with the commit; only set when materialized from the manifest on request.
 	Files map[string]FileData `json:"files,omitempty" bson:"files,omitempty"`
 	// ID of the user who made the commit.
 	// If empty, then the system created it.
 	AuthorID string `json:"author_id,omitempty" bson:"author_id,omitempty"`
+	// IDs of the commits that this commit reverts, if it was created by a revert.
+	RevertedCommitIDs []primitive.ObjectID `json:"reverted_commit_ids,omitempty" bson:"reverted_commit_ids,omitempty"`
+	// ID of the commit that this commit was cherry-picked from, if any.
+	CherryPickedFromID primitive.ObjectID `json:"cherry_picked_from_id,omitempty" bson:"cherry_picked_from_id,omitempty"`
+	// Base64-encoded ed25519 signature of the commit's canonical serialization, if it was signed.
+	Signature string `json:"signature,omitempty" bson:"signature,omitempty"`
+	// ID of the signing key that produced `signature`.
+	SigningKeyID primitive.ObjectID `json:"signing_key_id,omitempty" bson:"signing_key_id,omitempty"`
+	// If `true`, the signature was verified against one of the author's signing keys when the commit was created.
+	Verified bool `json:"verified" bson:"verified"`
 }
 
 // Request body for `CreateCommit`.
 type CreateCommitRequest struct {
-	Message string `json:"message"`
+	// ID of the commit the client expects the branch to currently point to.
+	// If the branch has moved since, the commit is rejected.
+	ParentCommitID string `json:"parent_commit_id" validate:"required"`
+	Message        string `json:"message"`
 	// Array of relative fs paths to created files (uploaded as snapshots)
 	CreatedFiles []string `json:"created_files"`
 	// Array of relative fs paths to modified files (uploaded as snapshots)
 	ModifiedFiles []string `json:"modified_files"`
 	// Array of relative fs paths to deleted files
 	DeletedFiles []string `json:"deleted_files"`
-	// Map of relative fs paths to their associated data
+	// Map of relative fs paths to their associated data.
+	// Only entries for created and modified files are required; other entries are ignored.
 	Files map[string]FileData `json:"files,omitempty" validate:"required"`
-	// ID of the user who made the commit.
-	// If empty, then the system created it.
-	AuthorID string `json:"author_id"`
+	// Optional base64-encoded ed25519 signature of the commit's canonical serialization (parent IDs, data of created
+	// and modified files, deleted files, and message), made with one of the author's registered signing keys.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Request body for `UpdateCommit`.
+type UpdateCommitRequest struct {
+	Message string `json:"message" validate:"required"`
+}
+
+// Request body for `PrecheckCommit`.
+type PrecheckCommitRequest struct {
+	// ID of the commit the client's changes are based on.
+	ParentCommitID string `json:"parent_commit_id" validate:"required"`
+	// Relative fs paths that the client intends to create, modify, or delete.
+	Paths []string `json:"paths" validate:"required,min=1"`
+}
+
+// Request body for `RevertCommits`.
+type RevertCommitsRequest struct {
+	// Index of the first (oldest) commit to revert.
+	FromIndex int `json:"from_index" validate:"required,gt=0"`
+	// Index of the last (newest) commit to revert. If omitted, only `from_index` is reverted.
+	ToIndex int `json:"to_index,omitempty" validate:"omitempty,gtefield=FromIndex"`
+	// Message of the revert commit. If omitted, one is generated.
+	Message string `json:"message,omitempty"`
+}
+
+// Request body for `CherryPickCommits`.
+type CherryPickRequest struct {
+	// Name of the branch that the commits are picked from.
+	SourceBranch string `json:"source_branch" validate:"required"`
+	// Indexes of the commits to apply, in any order. They are applied oldest first.
+	CommitIndexes []int `json:"commit_indexes" validate:"required,min=1,dive,gt=0"`
+}
+
+// A path whose version on the target branch differs from the version the cherry-picked commit was based on.
+type CherryPickConflict struct {
+	CommitIndex int    `json:"commit_index"`
+	Path        string `json:"path"`
+}
+
+// Request body for `SquashCommits`.
+type SquashCommitsRequest struct {
+	// Index of the first (oldest) commit to squash.
+	FromIndex int `json:"from_index" validate:"required,gt=0"`
+	// Index of the last (newest) commit to squash. Legacy indexes may be lower than `FromIndex`, so the order is
+	// checked against the branch's history.
+	ToIndex int `json:"to_index" validate:"required,gt=0"`
+	// Message of the squashed commit. If omitted, the messages of the squashed commits are combined.
+	Message string `json:"message,omitempty"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// [Database model]
+//
+// Monotonic counter used to allocate project-wide commit indexes.
+type Counter struct {
+	// ID of the project that the counter belongs to.
+	ID primitive.ObjectID `json:"_id" bson:"_id"`
+	// Last allocated commit index.
+	Seq int `json:"seq" bson:"seq"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of events sent to users.
+const (
+	EventTypeUnlockRequested       = "unlock_requested"
+	EventTypeUnlockRequestApproved = "unlock_request_approved"
+	EventTypeUnlockRequestDeclined = "unlock_request_declined"
+	EventTypeLockForceReleased     = "lock_force_released"
+)
+
+// [Database model]
+//
+// Event sent to a user's event stream. Events are kept for a while after they're sent, so clients that were offline
+// can catch up on them.
+type Event struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	UserID    string             `json:"-" bson:"user_id"`
+	Type      string             `json:"type" bson:"type"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	// JSON encoding of the object the event is about, as it's returned by the API.
+	Data json.RawMessage `json:"data" bson:"data"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Commit in a commit graph, with the lane it's drawn in.
+type GraphNode struct {
+	ID        primitive.ObjectID `json:"_id"`
+	CreatedAt time.Time          `json:"created_at"`
+	Index     int                `json:"index"`
+	BranchID  primitive.ObjectID `json:"branch_id"`
+	Message   string             `json:"message,omitempty"`
+	AuthorID  string             `json:"author_id,omitempty"`
+	// Zero-based lane (column) of the commit.
+	Lane    int         `json:"lane"`
+	Parents []GraphEdge `json:"parents"`
+	// Names of the branches pointing to this commit.
+	Branches []string `json:"branches,omitempty"`
+	// Names of the tags pointing to this commit.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Edge from a commit in a commit graph to one of its parents.
+type GraphEdge struct {
+	ID primitive.ObjectID `json:"_id"`
+	// Lane the parent is drawn in, or -1 if the parent is not part of the graph (e.g. it was made in a branch that
+	// wasn't selected).
+	Lane int `json:"lane"`
+}
@@ -1,5 +1,88 @@
 package models
 
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// [Database model]
+//
+// Lock on a file path in a branch, preventing other users from changing the file.
+type Lock struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	BranchID  primitive.ObjectID `json:"branch_id" bson:"branch_id"`
+	Path      string             `json:"path" bson:"path"`
+	// ID of the user holding the lock.
+	UserID string `json:"user_id" bson:"user_id"`
+	// Optional reason given by the user for locking the file.
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+	// Optional time after which the lock no longer applies. Expired locks are released by a scheduled job.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	// Number of minutes that renewing the lock extends it by. Only set if the lock expires.
+	TTLMinutes int `json:"ttl_minutes,omitempty" bson:"ttl_minutes,omitempty"`
+	// Time the holder was notified that the lock is about to expire. Cleared when the lock is renewed.
+	ExpiryWarnedAt *time.Time `json:"-" bson:"expiry_warned_at,omitempty"`
+}
+
 type LockOrUnlockRequest struct {
 	Paths []string `json:"paths" validate:"required"`
+	// Only used when locking.
+	Reason string `json:"reason,omitempty" validate:"max=512"`
+	// Only used when locking. Takes precedence over `ttl_minutes`.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Only used when locking. Number of minutes until the lock expires. Defaults to the project's default lock TTL.
+	TTLMinutes int `json:"ttl_minutes,omitempty" validate:"min=0"`
+}
+
+type RenewLocksRequest struct {
+	// Paths or directories to renew the locks of. If empty, all of the user's locks in the branch are renewed.
+	Paths []string `json:"paths,omitempty"`
+	// Number of minutes from now until the locks expire. Defaults to each lock's own TTL.
+	TTLMinutes int `json:"ttl_minutes,omitempty" validate:"min=0"`
+}
+
+type UnlockRequestStatus string
+
+const (
+	UnlockRequestStatusPending  UnlockRequestStatus = "pending"
+	UnlockRequestStatusApproved UnlockRequestStatus = "approved"
+	UnlockRequestStatusDeclined UnlockRequestStatus = "declined"
+	// The lock was released by other means (unlocked, force unlocked, expired or given to another requester) before
+	// the holder responded.
+	UnlockRequestStatusCancelled UnlockRequestStatus = "cancelled"
+)
+
+// [Database model]
+//
+// Request by a user for the holder of a lock to release it.
+type UnlockRequest struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	BranchID  primitive.ObjectID `json:"branch_id" bson:"branch_id"`
+	LockID    primitive.ObjectID `json:"lock_id" bson:"lock_id"`
+	Path      string             `json:"path" bson:"path"`
+	// ID of the user holding the lock at the time of the request.
+	HolderID string `json:"holder_id" bson:"holder_id"`
+	// ID of the user who requested the lock to be released.
+	RequesterID string              `json:"requester_id" bson:"requester_id"`
+	Message     string              `json:"message,omitempty" bson:"message,omitempty"`
+	Status      UnlockRequestStatus `json:"status" bson:"status"`
+	// Whether the lock was transferred to the requester instead of being released. Only set if approved.
+	Transferred bool `json:"transferred,omitempty" bson:"transferred,omitempty"`
+	// Time the request was approved, declined or cancelled.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+}
+
+type CreateUnlockRequestRequest struct {
+	Path    string `json:"path" validate:"required"`
+	Message string `json:"message,omitempty" validate:"max=1024"`
+}
+
+type ApproveUnlockRequestRequest struct {
+	// If true, the lock is given to the requester instead of being released.
+	Transfer bool `json:"transfer,omitempty"`
 }
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// File entry in a manifest chunk.
+type ManifestEntry struct {
+	// Relative fs path of the file.
+	Path string   `json:"path" bson:"path"`
+	Data FileData `json:"data" bson:"data"`
+}
+
+// [Database model]
+//
+// Content-addressed chunk of a manifest, holding some or all of the file entries of a single directory.
+type ManifestChunk struct {
+	// SHA-256 hash (hexadecimal) of the chunk's entries.
+	ID string `json:"_id" bson:"_id"`
+	// File entries sorted by path.
+	Entries []ManifestEntry `json:"entries" bson:"entries"`
+	// Last time a manifest using the chunk was written. Not set on chunks written before it was recorded.
+	WrittenAt *time.Time `json:"written_at,omitempty" bson:"written_at,omitempty"`
+}
+
+// Reference from a manifest to a chunk holding file entries of a directory.
+type ManifestChunkRef struct {
+	// Directory path, or "." for files at the root of the project.
+	Dir     string `json:"dir" bson:"dir"`
+	ChunkID string `json:"chunk_id" bson:"chunk_id"`
+}
+
+// [Database model]
+//
+// Content-addressed root of a manifest, describing the full file state of a commit.
+type Manifest struct {
+	// SHA-256 hash (hexadecimal) of the chunk references.
+	ID string `json:"_id" bson:"_id"`
+	// Chunk references sorted by directory, and by path within a directory.
+	Chunks []ManifestChunkRef `json:"chunks" bson:"chunks"`
+	// Last time the manifest was written. Not set on manifests written before it was recorded.
+	WrittenAt *time.Time `json:"written_at,omitempty" bson:"written_at,omitempty"`
+}
+
+// Net changes between two manifests.
+type ManifestDiff struct {
+	// Map of relative fs paths to the data of files that only exist in the newer manifest.
+	Created map[string]FileData `json:"created"`
+	// Map of relative fs paths to the newer data of files that exist in both manifests but differ.
+	Modified map[string]FileData `json:"modified"`
+	// Relative fs paths of files that only exist in the older manifest.
+	Deleted []string `json:"deleted"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// [Database model]
+//
+// Record of a database migration that has been applied or is being applied.
+type Migration struct {
+	// Unique name of the migration.
+	ID string `json:"_id" bson:"_id"`
+	// Time the migration finished. Not set while it's running.
+	AppliedAt *time.Time `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+	// Time until which the server instance running the migration holds its claim. Once it has passed without the
+	// migration being applied (e.g. because the instance crashed), another instance may claim it.
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty" bson:"lease_expires_at,omitempty"`
+}
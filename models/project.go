@@ -19,6 +19,43 @@ type Project struct {
 	// If `true`, modified committed files in this project will be uploaded as patches instead of snapshots (e.g. the
 	// whole file).
 	EnablePatchRevisions bool `json:"enable_patch_revisions" bson:"enable_patch_revisions"`
+	// Number of approvals a change request needs before it can be merged.
+	RequiredApprovals int `json:"required_approvals" bson:"required_approvals"`
+	// Number of minutes after which file locks expire, unless a different TTL is requested when locking.
+	// If 0, locks don't expire by default.
+	DefaultLockTTLMinutes int `json:"default_lock_ttl_minutes" bson:"default_lock_ttl_minutes"`
+	// Protection rules for branches whose names match the rule's pattern.
+	BranchProtectionRules []BranchProtectionRule `json:"branch_protection_rules,omitempty" bson:"branch_protection_rules,omitempty"`
+	// Glob patterns of files that can't be merged (e.g. `*.uasset`). Changing or deleting a matching file requires
+	// holding its lock. Patterns without a slash are matched against file names, others against full paths.
+	ExclusiveCheckoutPatterns []string `json:"exclusive_checkout_patterns,omitempty" bson:"exclusive_checkout_patterns,omitempty"`
+}
+
+// Protection rule for branches whose names match a pattern.
+type BranchProtectionRule struct {
+	// Branch name or glob pattern (e.g. "release-*"), matched with `path.Match`.
+	Pattern string `json:"pattern" bson:"pattern" validate:"required"`
+	// Minimum team role required to commit to the branch. Any team member can commit if empty.
+	MinCommitRole Role `json:"min_commit_role,omitempty" bson:"min_commit_role,omitempty" validate:"omitempty,oneof=collab admin owner"`
+	// If `true`, nobody can squash, delete or restore commits in the branch.
+	ForbidHistoryRewrite bool `json:"forbid_history_rewrite" bson:"forbid_history_rewrite"`
+	// If `true`, the branch cannot be deleted.
+	ForbidDeletion bool `json:"forbid_deletion" bson:"forbid_deletion"`
+	// If `true`, the branch cannot be renamed.
+	ForbidRename bool `json:"forbid_rename" bson:"forbid_rename"`
+	// If `true`, commits with more than one parent (e.g. merge commits) cannot be added to the branch.
+	RequireLinearHistory bool `json:"require_linear_history" bson:"require_linear_history"`
+}
+
+// Effective protection of a branch, combining all rules that match its name.
+type BranchProtection struct {
+	// `true` if the branch is the project's default branch or matches at least one protection rule.
+	Protected            bool `json:"protected"`
+	MinCommitRole        Role `json:"min_commit_role,omitempty"`
+	ForbidHistoryRewrite bool `json:"forbid_history_rewrite"`
+	ForbidDeletion       bool `json:"forbid_deletion"`
+	ForbidRename         bool `json:"forbid_rename"`
+	RequireLinearHistory bool `json:"require_linear_history"`
 }
 
 type CreateProjectRequest struct {
@@ -37,6 +74,18 @@ type UpdateProjectRequest struct {
 	// If `true`, modified committed files in this project will be uploaded as patches instead of snapshots (e.g. the
 	// whole file).
 	// EnablePatchRevisions bool `json:"enable_patch_revisions,omitempty"`
+	// Number of approvals a change request needs before it can be merged. Can only be changed by admins.
+	RequiredApprovals *int `json:"required_approvals,omitempty"`
+	// Number of minutes after which file locks expire by default (0 to disable). Can only be changed by admins.
+	DefaultLockTTLMinutes *int `json:"default_lock_ttl_minutes,omitempty"`
+}
+
+type UpdateBranchProtectionRulesRequest struct {
+	Rules []BranchProtectionRule `json:"rules" validate:"dive"`
+}
+
+type UpdateExclusiveCheckoutPatternsRequest struct {
+	Patterns []string `json:"patterns" validate:"dive,required"`
 }
 
 type InviteManyUsersDTO struct {
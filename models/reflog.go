@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Operations that move a branch's head.
+const (
+	ReflogOperationCreate     = "create"
+	ReflogOperationCommit     = "commit"
+	ReflogOperationRevert     = "revert"
+	ReflogOperationCherryPick = "cherry-pick"
+	ReflogOperationSquash     = "squash"
+	ReflogOperationReset      = "reset"
+	ReflogOperationRestore    = "restore"
+	ReflogOperationMerge      = "merge"
+)
+
+// [Database model]
+//
+// Record of a branch's head moving from one commit to another.
+type ReflogEntry struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	BranchID  primitive.ObjectID `json:"branch_id" bson:"branch_id"`
+	// ID of the commit the branch pointed to before the operation. Empty if the branch was created by the operation.
+	OldCommitID primitive.ObjectID `json:"old_commit_id,omitempty" bson:"old_commit_id,omitempty"`
+	// ID of the commit the branch points to after the operation.
+	NewCommitID primitive.ObjectID `json:"new_commit_id" bson:"new_commit_id"`
+	// ID of the user who performed the operation.
+	// If empty, then the system performed it.
+	UserID    string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Operation string `json:"operation" bson:"operation"`
+	// IDs of the commits that were removed from the branch's history by the operation, if any.
+	RemovedCommitIDs []primitive.ObjectID `json:"removed_commit_ids,omitempty" bson:"removed_commit_ids,omitempty"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// [Database model]
+//
+// Ed25519 public key that a user signs commits with.
+type SigningKey struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	// ID of the user in our auth provider.
+	UserID string `json:"user_id" bson:"user_id"`
+	// Display name of the key, e.g. the machine it was generated on.
+	Name string `json:"name" bson:"name"`
+	// Base64-encoded (standard encoding) ed25519 public key.
+	PublicKey string `json:"public_key" bson:"public_key"`
+}
+
+// Request body for `CreateSigningKey`.
+type CreateSigningKeyRequest struct {
+	// Display name of the key, e.g. the machine it was generated on.
+	Name string `json:"name" validate:"max=64"`
+	// Base64-encoded (standard encoding) ed25519 public key.
+	PublicKey string `json:"public_key" validate:"required"`
+}
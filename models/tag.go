@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// [Database model]
+//
+// Immutable named pointer to a commit, e.g. the commit a build was shipped from.
+type Tag struct {
+	ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	// Tag name that must be unique in the scope of the project.
+	Name      string             `json:"name" bson:"name"`
+	ProjectID primitive.ObjectID `json:"project_id" bson:"project_id"`
+	// ID of the tagged commit.
+	CommitID primitive.ObjectID `json:"commit_id" bson:"commit_id"`
+	// Index of the tagged commit.
+	CommitIndex int `json:"commit_index" bson:"commit_index"`
+	// ID of the user who created the tag.
+	AuthorID string `json:"author_id" bson:"author_id"`
+	// Optional release notes.
+	ReleaseNotes string `json:"release_notes,omitempty" bson:"release_notes,omitempty"`
+}
+
+// Request body for `CreateTag`.
+type CreateTagRequest struct {
+	// Tag name that must be unique in the scope of the project.
+	Name string `json:"name" validate:"required,max=128"`
+	// Commit to tag, either as a commit index or the name of another tag.
+	Commit string `json:"commit" validate:"required"`
+	// Optional release notes.
+	ReleaseNotes string `json:"release_notes,omitempty"`
+}
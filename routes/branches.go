@@ -9,15 +9,27 @@ import (
 
 func RouteBranches(router fiber.Router) {
 	router.Use(middleware.IsAuthenticated, middleware.HasTeamAccess(models.RoleNone))
+	router.Use("/:branch_name", middleware.HasBranchAccess)
 
 	router.Get("/", controllers.GetManyBranches)
 	router.Post("/", controllers.CreateBranch)
 	router.Get("/default", controllers.GetDefaultBranch)
+	router.Get("/deleted", controllers.GetManyDeletedBranches)
+	router.Post("/deleted/:branch_id/restore", controllers.UndeleteBranch)
 	router.Get("/:branch_name", controllers.GetOneBranch)
 	router.Put("/:branch_name", controllers.UpdateBranch)
 	router.Delete("/:branch_name", controllers.SoftDeleteOneBranch)
 	router.Post("/:branch_name/commit", controllers.CreateCommit)
+	router.Post("/:branch_name/commit/precheck", controllers.PrecheckCommit)
+	router.Get("/:branch_name/changes", controllers.GetBranchChanges)
+	router.Get("/:branch_name/manifest", controllers.GetBranchManifest)
 	router.Delete("/:branch_name/commits", controllers.DeleteManyCommitsInBranch)
+	router.Post("/:branch_name/revert", controllers.RevertCommits)
+	router.Post("/:branch_name/cherry-pick", controllers.CherryPickCommits)
+	router.Post("/:branch_name/squash", controllers.SquashCommits)
+	router.Post("/:branch_name/publish", controllers.PublishBranch)
+	router.Get("/:branch_name/reflog", controllers.GetBranchReflog)
+	router.Post("/:branch_name/reflog/:entry_id/restore", controllers.RestoreBranch)
 
 	RouteLocks(router.Group("/:branch_name/locks"))
 }
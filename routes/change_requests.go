@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/decentvcs/server/controllers"
+	"github.com/decentvcs/server/middleware"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func RouteChangeRequests(router fiber.Router) {
+	router.Use(middleware.IsAuthenticated)
+
+	router.Get("/", middleware.HasTeamAccess(models.RoleNone), controllers.GetManyChangeRequests)
+	router.Post("/", middleware.HasTeamAccess(models.RoleNone), controllers.CreateChangeRequest)
+	router.Get("/:change_request_id", middleware.HasTeamAccess(models.RoleNone), controllers.GetOneChangeRequest)
+	router.Get("/:change_request_id/diff", middleware.HasTeamAccess(models.RoleNone), controllers.GetChangeRequestDiff)
+	router.Post("/:change_request_id/close", middleware.HasTeamAccess(models.RoleNone), controllers.CloseChangeRequest)
+	router.Post("/:change_request_id/merge", middleware.HasTeamAccess(models.RoleNone), controllers.MergeChangeRequest)
+	router.Get("/:change_request_id/reviews", middleware.HasTeamAccess(models.RoleNone), controllers.GetManyChangeRequestReviews)
+	router.Post("/:change_request_id/reviews", middleware.HasTeamAccess(models.RoleNone), controllers.CreateChangeRequestReview)
+	router.Get("/:change_request_id/comments", middleware.HasTeamAccess(models.RoleNone), controllers.GetManyChangeRequestComments)
+	router.Post("/:change_request_id/comments", middleware.HasTeamAccess(models.RoleNone), controllers.CreateChangeRequestComment)
+}
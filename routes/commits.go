@@ -11,6 +11,9 @@ func RouteCommits(router fiber.Router) {
 	router.Use(middleware.IsAuthenticated, middleware.HasTeamAccess(models.RoleNone))
 
 	router.Get("/", controllers.GetManyCommits)
+	router.Get("/search", controllers.SearchCommits)
+	router.Get("/graph", controllers.GetCommitGraph)
 	router.Get("/:commit_index", controllers.GetOneCommit)
+	router.Get("/:commit_index/manifest", controllers.GetCommitManifest)
 	router.Put("/:commit_index", controllers.UpdateCommit)
 }
@@ -2,10 +2,24 @@ package routes
 
 import (
 	"github.com/decentvcs/server/controllers"
+	"github.com/decentvcs/server/middleware"
+	"github.com/decentvcs/server/models"
 	"github.com/gofiber/fiber/v2"
 )
 
 func RouteLocks(router fiber.Router) {
+	router.Get("/", controllers.GetManyBranchLocks)
 	router.Post("/", controllers.Lock)
 	router.Delete("/", controllers.Unlock)
+	router.Post("/renew", controllers.RenewLocks)
+	router.Get("/requests", controllers.GetManyUnlockRequests)
+	router.Post("/requests", controllers.CreateUnlockRequest)
+	router.Post("/requests/:request_id/approve", controllers.ApproveUnlockRequest)
+	router.Post("/requests/:request_id/decline", controllers.DeclineUnlockRequest)
+}
+
+func RouteProjectLocks(router fiber.Router) {
+	router.Use(middleware.IsAuthenticated)
+
+	router.Get("/", middleware.HasTeamAccess(models.RoleNone), controllers.GetManyProjectLocks)
 }
@@ -13,6 +13,8 @@ func RouteProjects(router fiber.Router) {
 	router.Post("/", middleware.HasTeamAccess(models.RoleNone), controllers.CreateProject)
 	router.Get("/", middleware.HasTeamAccess(models.RoleNone), controllers.GetOneProject)
 	router.Put("/", middleware.HasTeamAccess(models.RoleNone), controllers.UpdateProject)
+	router.Put("/branch_protection", middleware.HasTeamAccess(models.RoleAdmin), controllers.UpdateBranchProtectionRules)
+	router.Put("/exclusive_checkout", middleware.HasTeamAccess(models.RoleAdmin), controllers.UpdateExclusiveCheckoutPatterns)
 	router.Delete("/", middleware.HasTeamAccess(models.RoleOwner), controllers.DeleteOneProject)
 	router.Post("/transfer", middleware.HasTeamAccess(models.RoleOwner), controllers.TransferProjectOwnership)
 }
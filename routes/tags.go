@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"github.com/decentvcs/server/controllers"
+	"github.com/decentvcs/server/middleware"
+	"github.com/decentvcs/server/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func RouteTags(router fiber.Router) {
+	router.Use(middleware.IsAuthenticated)
+
+	router.Get("/", middleware.HasTeamAccess(models.RoleNone), controllers.GetManyTags)
+	router.Post("/", middleware.HasTeamAccess(models.RoleNone), controllers.CreateTag)
+	router.Get("/:tag_name", middleware.HasTeamAccess(models.RoleNone), controllers.GetOneTag)
+	router.Delete("/:tag_name", middleware.HasTeamAccess(models.RoleAdmin), controllers.DeleteOneTag)
+}
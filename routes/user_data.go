@@ -11,4 +11,8 @@ func RouteUserData(router fiber.Router) {
 
 	router.Get("/me", controllers.GetUserData)
 	router.Put("/me", controllers.UpdateUserData)
+	router.Get("/me/events", controllers.GetMyEvents)
+	router.Get("/me/signing_keys", controllers.GetManySigningKeys)
+	router.Post("/me/signing_keys", controllers.CreateSigningKey)
+	router.Delete("/me/signing_keys/:key_id", controllers.DeleteSigningKey)
 }